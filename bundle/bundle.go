@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/wirebase/wire/vfsgen"
 )
@@ -12,7 +13,8 @@ import (
 // Bundle describes the directory in which all static assets to eventually
 // generate an embeddable filesystem
 type Bundle struct {
-	dir string
+	dir      string
+	manifest map[string]string
 }
 
 // New creates a new bundle
@@ -39,13 +41,56 @@ func (b *Bundle) Clear() (err error) {
 	return
 }
 
-// Write the bundle as an go file that embeds the assets in the bundle
-func (b *Bundle) Write(o string) error {
+// WriteOption changes how the embed file is written
+type WriteOption func(opt *vfsgen.Options)
+
+// GoEmbed writes the assets to a directory next to the embed file that is
+// included with a go:embed directive, instead of into the embed file itself.
+// This requires the go.mod of the project to declare go 1.16 or later.
+func GoEmbed() WriteOption {
+	return func(opt *vfsgen.Options) { opt.Embed = true }
+}
+
+// Encodings stores the assets in additional content encodings, if that makes
+// them smaller.
+func Encodings(encs ...vfsgen.Encoding) WriteOption {
+	return func(opt *vfsgen.Options) { opt.Encodings = append(opt.Encodings, encs...) }
+}
+
+// CompressionLevel sets the gzip compression level of the assets, such as
+// gzip.BestSpeed during development and gzip.BestCompression for releases.
+func CompressionLevel(level int) WriteOption {
+	return func(opt *vfsgen.Options) { opt.CompressionLevel = level }
+}
+
+// ModTime sets the modification time of all assets to 't', such that the
+// embed file only changes if the content of the assets does. Since the bundle
+// dir is created anew for every bundle, the mod times otherwise always change.
+func ModTime(t time.Time) WriteOption {
+	return func(opt *vfsgen.Options) { opt.ModTime = &t }
+}
+
+// Cache reuses the compressed assets of earlier writes for assets that didn't
+// change, the cache should only be used for writing the same embed file.
+func Cache(c *vfsgen.Cache) WriteOption {
+	return func(opt *vfsgen.Options) { opt.Cache = c }
+}
+
+// Write the bundle as an go file that embeds the assets in the bundle, the file
+// is left untouched if its content would not change
+func (b *Bundle) Write(o string, opts ...WriteOption) error {
 	fs := http.Dir(b.dir)
-	if err := vfsgen.Generate(fs, vfsgen.Options{
+	vopt := vfsgen.Options{
 		Filename:  o,
 		BuildTags: "!wasm",
-	}); err != nil {
+		Manifest:  b.manifest,
+	}
+
+	for _, opt := range opts {
+		opt(&vopt)
+	}
+
+	if err := vfsgen.Generate(fs, vopt); err != nil {
 		return fmt.Errorf("failed to generate embed file: %w", err)
 	}
 
@@ -1,10 +1,13 @@
 package bundle_test
 
 import (
+	"bytes"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/wirebase/wire/bundle"
 )
@@ -32,3 +35,161 @@ func TestBundling(t *testing.T) {
 		t.Fatalf("expected file to no longer exist due to clear")
 	}
 }
+
+func TestTransform(t *testing.T) {
+	b, err := bundle.New()
+	if err != nil {
+		t.Fatalf("failed to create bundle, got: %v", err)
+	}
+
+	defer b.Clear()
+
+	var seen []string
+	err = b.Transform(
+		bundle.Add("css/main.css", []byte("body {  color: red;  }")),
+		bundle.Add("css/main.css.map", []byte("{}")),
+		bundle.Add("index.html", []byte("<html></html>")),
+		bundle.Rewrite("*.css", func(rel string, data []byte) ([]byte, error) {
+			seen = append(seen, rel)
+			return bytes.Join(bytes.Fields(data), []byte(" ")), nil
+		}),
+		bundle.Remove("*.map"),
+		bundle.Command{Args: []string{"sh", "-c", "cp index.html $WIRE_BUNDLE_DIR/404.html"}},
+	)
+	if err != nil {
+		t.Fatalf("failed to transform, got: %v", err)
+	}
+
+	if len(seen) != 1 || seen[0] != "css/main.css" {
+		t.Fatalf("expected only the css file to be rewritten, got: %v", seen)
+	}
+
+	data, _ := ioutil.ReadFile(filepath.Join(b.Dir(), "css", "main.css"))
+	if string(data) != "body { color: red; }" {
+		t.Fatalf("expected css to be rewritten, got: %s", data)
+	}
+
+	if _, err = os.Stat(filepath.Join(b.Dir(), "css", "main.css.map")); !os.IsNotExist(err) {
+		t.Fatalf("expected map file to be removed, got: %v", err)
+	}
+
+	if _, err = os.Stat(filepath.Join(b.Dir(), "404.html")); err != nil {
+		t.Fatalf("expected command to add a file, got: %v", err)
+	}
+
+	t.Run("failure stops pipeline", func(t *testing.T) {
+		err = b.Transform(
+			bundle.Command{Args: []string{"sh", "-c", "echo broken; exit 2"}},
+			bundle.Add("never.txt", nil),
+		)
+		if err == nil || !strings.Contains(err.Error(), "step 0 failed: command 'sh -c echo broken; exit 2' failed: exit status 2:\nbroken") {
+			t.Fatalf("expected command failure, got: %v", err)
+		}
+
+		if _, err = os.Stat(filepath.Join(b.Dir(), "never.txt")); !os.IsNotExist(err) {
+			t.Fatalf("expected pipeline to stop at the failing step")
+		}
+	})
+	t.Run("timeout", func(t *testing.T) {
+		start := time.Now()
+		err = b.Transform(bundle.Command{Args: []string{"sh", "-c", "sleep 3; true"}, Timeout: time.Millisecond * 100})
+		if err == nil || !strings.Contains(err.Error(), "command 'sh -c sleep 3; true' failed: timed out after 100ms") {
+			t.Fatalf("expected command to time out, got: %v", err)
+		}
+
+		if time.Since(start) > time.Second*2 {
+			t.Fatalf("expected command to be killed after the timeout, took: %s", time.Since(start))
+		}
+	})
+}
+
+func TestCopy(t *testing.T) {
+	b, err := bundle.New()
+	if err != nil {
+		t.Fatalf("failed to create bundle, got: %v", err)
+	}
+
+	defer b.Clear()
+
+	src, _ := ioutil.TempDir("", "bundle_test_src")
+	defer os.RemoveAll(src)
+	os.MkdirAll(filepath.Join(src, "img", ".cache"), 0777)
+	os.MkdirAll(filepath.Join(src, "drafts"), 0777)
+	ioutil.WriteFile(filepath.Join(src, "index.html"), []byte("<html></html>"), 0444)
+	ioutil.WriteFile(filepath.Join(src, ".DS_Store"), nil, 0666)
+	ioutil.WriteFile(filepath.Join(src, "img", "logo.png"), []byte("png"), 0666)
+	ioutil.WriteFile(filepath.Join(src, "img", ".cache", "x"), nil, 0666)
+	ioutil.WriteFile(filepath.Join(src, "drafts", "post.html"), nil, 0666)
+
+	err = b.Transform(bundle.Copy(src, ".*", "drafts"))
+	if err != nil {
+		t.Fatalf("failed to copy, got: %v", err)
+	}
+
+	var files []string
+	filepath.Walk(b.Dir(), func(p string, fi os.FileInfo, err error) error {
+		if err == nil && !fi.IsDir() {
+			rel, _ := filepath.Rel(b.Dir(), p)
+			files = append(files, filepath.ToSlash(rel))
+		}
+
+		return nil
+	})
+
+	if strings.Join(files, ",") != "img/logo.png,index.html" {
+		t.Fatalf("expected only these files to be copied, got: %v", files)
+	}
+	fi, err := os.Stat(filepath.Join(b.Dir(), "index.html"))
+	if err != nil || fi.Mode().Perm()&0200 == 0 {
+		t.Fatalf("expected copy of read-only file to be writable, got: %v %v", fi, err)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	b, err := bundle.New()
+	if err != nil {
+		t.Fatalf("failed to create bundle, got: %v", err)
+	}
+
+	defer b.Clear()
+
+	err = b.Transform(
+		bundle.Add("index.html", []byte("<html></html>")),
+		bundle.Add("css/main.css", []byte("body{}")),
+	)
+	if err != nil {
+		t.Fatalf("failed to transform, got: %v", err)
+	}
+
+	err = b.Fingerprint("*.css")
+	if err != nil {
+		t.Fatalf("failed to fingerprint, got: %v", err)
+	}
+
+	// sha256("body{}")
+	exp := "/css/main.7c98040a54165758.css"
+	if p := b.Path("css/main.css"); p != exp {
+		t.Fatalf("expected fingerprinted path %s, got: %v", exp, p)
+	}
+
+	if p := b.Path("index.html"); p != "/index.html" {
+		t.Fatalf("expected index to keep its path, got: %v", p)
+	}
+
+	if _, err = os.Stat(filepath.Join(b.Dir(), filepath.FromSlash(exp))); err != nil {
+		t.Fatalf("expected fingerprinted file to exist, got: %v", err)
+	}
+
+	dir, _ := ioutil.TempDir("", "bundle_test")
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "assets.go")
+	err = b.Write(p)
+	if err != nil {
+		t.Fatalf("failed to write bundle, got: %v", err)
+	}
+
+	data, _ := ioutil.ReadFile(p)
+	if !strings.Contains(string(data), `m["/css/main.css"] = "`+exp+`"`) {
+		t.Fatalf("expected manifest in embed file, got: %s", data)
+	}
+}
@@ -0,0 +1,83 @@
+package bundle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// Fingerprint renames every file in the bundle that matches any of the patterns
+// to include a hash of its content, i.e: 'main.wasm' becomes 'main.<hash>.wasm'.
+// The logical path of each renamed file is mapped to its new path in a manifest
+// that is written to the embed file, such that the fingerprinted path can be
+// resolved at runtime. Since the name changes whenever the content changes these
+// files can be cached by browsers indefinitely.
+func (b *Bundle) Fingerprint(patterns ...string) (err error) {
+	if b.manifest == nil {
+		b.manifest = map[string]string{}
+	}
+
+	err = walkFiles(b.dir, patterns, func(p, rel string) error {
+		hash, err := hashFile(p)
+		if err != nil {
+			return fmt.Errorf("failed to hash '%s': %w", rel, err)
+		}
+
+		hashed := FingerprintPath(rel, hash)
+		err = os.Rename(p, filepath.Join(b.dir, filepath.FromSlash(hashed)))
+		if err != nil {
+			return fmt.Errorf("failed to rename '%s': %w", rel, err)
+		}
+
+		b.manifest["/"+rel] = "/" + hashed
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to fingerprint bundle: %w", err)
+	}
+
+	return
+}
+
+// Manifest returns the logical path of every file that was fingerprinted mapped
+// to its fingerprinted path, both starting with a slash.
+func (b *Bundle) Manifest() map[string]string { return b.manifest }
+
+// Path returns the path under which the file with slash separated logical
+// path 'p' is stored in the bundle, starting with a slash.
+func (b *Bundle) Path(p string) string {
+	p = path.Clean("/" + p)
+	if hashed, ok := b.manifest[p]; ok {
+		return hashed
+	}
+
+	return p
+}
+
+// FingerprintPath returns the slash separated path 'p' with the hash inserted
+// before the extension of the file name.
+func FingerprintPath(p, hash string) string {
+	ext := path.Ext(p)
+	return p[:len(p)-len(ext)] + "." + hash + ext
+}
+
+// hashFile returns the first 16 hex characters of the sha256 of a file's content
+func hashFile(p string) (hash string, err error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+
+	defer f.Close()
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil))[:16], nil
+}
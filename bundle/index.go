@@ -0,0 +1,49 @@
+package bundle
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// indexPage bootstraps the wasm binary in the browser using wasm_exec.js
+var indexPage = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <script src="{{.Exec}}"></script>
+  <script>
+    const go = new Go();
+    WebAssembly.instantiateStreaming(fetch("{{.Wasm}}"), go.importObject).then((result) => {
+      go.run(result.instance);
+    });
+  </script>
+</head>
+<body></body>
+</html>
+`))
+
+// Index returns a transformer that writes an index.html to the root of the
+// bundle that loads and runs the wasm binary at slash separated path 'wasm'
+// with the wasm_exec.js at path 'exec', both relative to the bundle root. An
+// existing index.html is kept as is.
+func Index(wasm, exec string) Transformer {
+	return TransformerFunc(func(dir string) error {
+		p := filepath.Join(dir, "index.html")
+		if _, err := os.Stat(p); err == nil {
+			return nil
+		}
+
+		buf := bytes.NewBuffer(nil)
+		err := indexPage.Execute(buf, struct{ Wasm, Exec string }{path.Clean("/" + wasm), path.Clean("/" + exec)})
+		if err != nil {
+			return fmt.Errorf("failed to render index.html: %w", err)
+		}
+
+		return Add("index.html", buf.Bytes()).Transform(dir)
+	})
+}
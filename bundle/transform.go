@@ -0,0 +1,291 @@
+package bundle
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/wirebase/wire/runner"
+)
+
+// Transformer operates on the assets in the bundle directory before it is
+// turned into an embed file. It may add, rewrite or remove files in 'dir'.
+type Transformer interface {
+	Transform(dir string) error
+}
+
+// TransformerFunc allows an ordinary function to be used as a Transformer
+type TransformerFunc func(dir string) error
+
+// Transform calls f(dir)
+func (f TransformerFunc) Transform(dir string) error { return f(dir) }
+
+// Pipeline runs transformers one after the other, the first one that fails
+// stops the pipeline.
+type Pipeline []Transformer
+
+// Transform runs each transformer of the pipeline on 'dir' in order
+func (p Pipeline) Transform(dir string) (err error) {
+	for i, t := range p {
+		err = t.Transform(dir)
+		if err != nil {
+			return fmt.Errorf("step %d failed: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// Transform runs the transformers on the bundle directory in order
+func (b *Bundle) Transform(ts ...Transformer) (err error) {
+	err = Pipeline(ts).Transform(b.dir)
+	if err != nil {
+		return fmt.Errorf("failed to transform bundle: %w", err)
+	}
+
+	return
+}
+
+// matchFile reports whether the slash separated path 'rel' of a file in the
+// bundle matches the pattern. Patterns without a slash match the base name
+// of the file in any directory.
+func matchFile(pattern, rel string) (bool, error) {
+	if !strings.Contains(pattern, "/") {
+		rel = path.Base(rel)
+	}
+
+	return path.Match(pattern, rel)
+}
+
+// walkFiles calls fn for every regular file in 'dir' that matches any of the
+// patterns, with its path relative to 'dir'.
+func walkFiles(dir string, patterns []string, fn func(p, rel string) error) error {
+	return filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.Mode().IsRegular() {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+
+		rel = filepath.ToSlash(rel)
+		for _, pattern := range patterns {
+			ok, err := matchFile(pattern, rel)
+			if err != nil {
+				return fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+			}
+
+			if ok {
+				return fn(p, rel)
+			}
+		}
+
+		return nil
+	})
+}
+
+// Remove returns a transformer that removes every file in the bundle that
+// matches any of the patterns, i.e: '*.map' or 'src/*.ts'.
+func Remove(patterns ...string) Transformer {
+	return TransformerFunc(func(dir string) error {
+		return walkFiles(dir, patterns, func(p, rel string) error {
+			err := os.Remove(p)
+			if err != nil {
+				return fmt.Errorf("failed to remove '%s': %w", rel, err)
+			}
+
+			return nil
+		})
+	})
+}
+
+// Rewrite returns a transformer that replaces the content of every file that
+// matches the pattern with what 'fn' returns for it, i.e: to minify it.
+func Rewrite(pattern string, fn func(rel string, data []byte) ([]byte, error)) Transformer {
+	return TransformerFunc(func(dir string) error {
+		return walkFiles(dir, []string{pattern}, func(p, rel string) error {
+			data, err := ioutil.ReadFile(p)
+			if err != nil {
+				return fmt.Errorf("failed to read '%s': %w", rel, err)
+			}
+
+			data, err = fn(rel, data)
+			if err != nil {
+				return fmt.Errorf("failed to rewrite '%s': %w", rel, err)
+			}
+
+			err = ioutil.WriteFile(p, data, 0666)
+			if err != nil {
+				return fmt.Errorf("failed to write '%s': %w", rel, err)
+			}
+
+			return nil
+		})
+	})
+}
+
+// Add returns a transformer that writes a file with the provided data to the
+// slash separated path 'rel' in the bundle, directories are created as needed.
+func Add(rel string, data []byte) Transformer {
+	return TransformerFunc(func(dir string) error {
+		p := filepath.Join(dir, filepath.FromSlash(rel))
+		err := os.MkdirAll(filepath.Dir(p), 0777)
+		if err != nil {
+			return fmt.Errorf("failed to create dir for '%s': %w", rel, err)
+		}
+
+		err = ioutil.WriteFile(p, data, 0666)
+		if err != nil {
+			return fmt.Errorf("failed to write '%s': %w", rel, err)
+		}
+
+		return nil
+	})
+}
+
+// AddFile returns a transformer that copies file 'src' to the slash separated
+// path 'rel' in the bundle, directories are created as needed.
+func AddFile(rel, src string) Transformer {
+	return TransformerFunc(func(dir string) error {
+		p := filepath.Join(dir, filepath.FromSlash(rel))
+		err := os.MkdirAll(filepath.Dir(p), 0777)
+		if err != nil {
+			return fmt.Errorf("failed to create dir for '%s': %w", rel, err)
+		}
+
+		err = copyFile(src, p)
+		if err != nil {
+			return fmt.Errorf("failed to copy '%s': %w", rel, err)
+		}
+
+		return nil
+	})
+}
+
+// Copy returns a transformer that copies every file in directory 'src' to the
+// same relative path in the bundle. Files and directories that match any of
+// the ignore patterns are skipped, a pattern without a slash matches the name
+// of a file or directory at any depth.
+func Copy(src string, ignore ...string) Transformer {
+	return TransformerFunc(func(dir string) error {
+		return filepath.Walk(src, func(p string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			rel, err := filepath.Rel(src, p)
+			if err != nil || rel == "." {
+				return err
+			}
+
+			rel = filepath.ToSlash(rel)
+			for _, pattern := range ignore {
+				ok, err := matchFile(pattern, rel)
+				if err != nil {
+					return fmt.Errorf("invalid ignore pattern '%s': %w", pattern, err)
+				}
+
+				if ok && fi.IsDir() {
+					return filepath.SkipDir
+				} else if ok {
+					return nil
+				}
+			}
+
+			dst := filepath.Join(dir, filepath.FromSlash(rel))
+			if fi.IsDir() {
+				return os.MkdirAll(dst, 0777)
+			}
+
+			err = copyFile(p, dst)
+			if err != nil {
+				return fmt.Errorf("failed to copy '%s': %w", rel, err)
+			}
+
+			return nil
+		})
+	})
+}
+
+// copyFile copies the content of file 'src' to file 'dst'. Anything that isn't
+// a regular file, or a link to one, is skipped. The copy is always writable
+// such that later transformers can change it, even if the source isn't.
+func copyFile(src, dst string) (err error) {
+	fi, err := os.Stat(src)
+	if err != nil || !fi.Mode().IsRegular() {
+		return err
+	}
+
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fi.Mode().Perm()|0200)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, f)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+
+	return
+}
+
+// Command is a transformer that runs an external program on the bundle dir.
+// The program is run with the WIRE_BUNDLE_DIR environment variable set.
+type Command struct {
+
+	// Args holds the program and the arguments to run
+	Args []string
+
+	// Dir is the working directory of the program, defaults to the bundle dir
+	Dir string
+
+	// Env holds environment variables that are added to the existing ones
+	Env []string
+
+	// Timeout is how long the command is allowed to run, Defaults to 30s
+	Timeout time.Duration
+
+	// Output receives what the program wrote when it succeeded, when it fails
+	// the output is part of the error instead.
+	Output io.Writer
+}
+
+// Transform runs the command on 'dir'
+func (c Command) Transform(dir string) (err error) {
+	if len(c.Args) < 1 {
+		return errors.New("command has no program to run")
+	}
+
+	cmd := exec.Command(c.Args[0], c.Args[1:]...)
+	cmd.Dir = c.Dir
+	if cmd.Dir == "" {
+		cmd.Dir = dir
+	}
+
+	cmd.Env = append(append(os.Environ(), "WIRE_BUNDLE_DIR="+dir), c.Env...)
+	out, err := runner.RunCommand(cmd, c.Timeout)
+	if err != nil {
+		return fmt.Errorf("command '%s' failed: %w", strings.Join(c.Args, " "), err)
+	}
+
+	if c.Output != nil && len(out) > 0 {
+		io.WriteString(c.Output, out)
+	}
+
+	return nil
+}
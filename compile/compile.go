@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
@@ -28,6 +29,9 @@ var (
 
 	// ErrNotAProgram is returned when the tool expected a main package
 	ErrNotAProgram = errors.New("no program to build, not a 'main' package")
+
+	// ErrNoWasmExec is returned when the wasm_exec.js support file couldn't be found
+	ErrNoWasmExec = errors.New("couldn't find 'wasm_exec.js' in the GOROOT")
 )
 
 // listErrs maps `go list` stderr message to error values we can easier assert
@@ -93,6 +97,30 @@ func (c *Compile) Build(o string, to time.Duration) (err error) {
 	return
 }
 
+// WasmExec returns the path to the wasm_exec.js file that is shipped with the
+// Go toolchain that is used for building. It is required to run the wasm
+// binaries it produces in the browser.
+func (c *Compile) WasmExec() (p string, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	stdo, _, err := c.runGo(ctx, "env", "GOROOT")
+	if err != nil {
+		return "", err
+	}
+
+	// since go1.24 it lives in lib/wasm, before that in misc/wasm
+	root := strings.TrimSpace(stdo.String())
+	for _, dir := range []string{"lib", "misc"} {
+		p = filepath.Join(root, dir, "wasm", "wasm_exec.js")
+		if _, err = os.Stat(p); err == nil {
+			return p, nil
+		}
+	}
+
+	return "", fmt.Errorf("inspecting '%s': %w", root, ErrNoWasmExec)
+}
+
 func (c *Compile) runGo(ctx context.Context, args ...string) (stdo, stde *bytes.Buffer, err error) {
 	stde = bytes.NewBuffer(nil)
 	stdo = bytes.NewBuffer(nil)
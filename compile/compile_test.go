@@ -132,4 +132,15 @@ func TestCompileBuilding(t *testing.T) {
 			t.Fatalf("expected program to output correctyl, got: %v", v)
 		}
 	})
+
+	t.Run("wasm exec", func(t *testing.T) {
+		p, err := c.WasmExec()
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		if filepath.Base(p) != "wasm_exec.js" {
+			t.Fatalf("expected path to wasm_exec.js, got: %v", p)
+		}
+	})
 }
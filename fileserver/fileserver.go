@@ -0,0 +1,280 @@
+// Package fileserver serves the filesystem that is embedded by the bundle. The
+// compressed bytes that are already embedded are served as is to clients
+// that accept them, responses carry strong ETags and fingerprinted assets are
+// cached by browsers indefinitely.
+package fileserver
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config configures the file server
+type Config struct {
+
+	// Manifest maps logical asset paths to their fingerprinted paths, such as
+	// the manifest variable in the embed file. Fingerprinted assets are cached
+	// indefinitely, requests for the logical path are served the same content.
+	Manifest map[string]string
+
+	// Encodings holds the content encodings that are served, in order of
+	// preference, if the file is stored in them and the client accepts them.
+	// Defaults to "br", "zstd" and "gzip".
+	Encodings []string
+
+	// MaxAge is how long browsers may cache assets that are not fingerprinted
+	// without checking if they changed. Defaults to 0, they always check.
+	MaxAge time.Duration
+}
+
+// gzipper is implemented by files that hold their content gzip compressed
+type gzipper interface {
+	GzipBytes() []byte
+}
+
+// encoder is implemented by files that hold their content in additional
+// content encodings
+type encoder interface {
+	EncodedBytes(name string) []byte
+}
+
+// Handler serves files from a http.FileSystem
+type Handler struct {
+	fs     http.FileSystem
+	cfg    Config
+	hashed map[string]bool // fingerprinted paths
+
+	mu     sync.Mutex
+	hashes map[string]string // content hash by path
+}
+
+// New creates a handler that serves files from 'fs'
+func New(fs http.FileSystem, cfg Config) (h *Handler) {
+	if len(cfg.Encodings) < 1 {
+		cfg.Encodings = []string{"br", "zstd", "gzip"}
+	}
+
+	h = &Handler{fs: fs, cfg: cfg, hashed: map[string]bool{}, hashes: map[string]string{}}
+	for _, p := range cfg.Manifest {
+		h.hashed[path.Clean("/"+p)] = true
+	}
+
+	return
+}
+
+// ServeHTTP serves the file at the request path. Directories are served their
+// index.html file, requests for them without a trailing slash are redirected
+// such that relative urls in the index resolve against the directory.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	p := path.Clean("/" + r.URL.Path)
+	if stored, ok := h.cfg.Manifest[p]; ok {
+		p = path.Clean("/" + stored)
+	}
+
+	f, fi, err := h.open(p)
+	if err != nil {
+		h.serveErr(w, err)
+		return
+	}
+
+	defer f.Close()
+	if fi.IsDir() {
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			target := path.Base(r.URL.Path) + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+
+			// relative, such that it works when the handler is mounted
+			// under a prefix
+			w.Header().Set("Location", target)
+			w.WriteHeader(http.StatusMovedPermanently)
+			return
+		}
+
+		p = path.Join(p, "index.html")
+		f, fi, err = h.open(p)
+		if err != nil || fi.IsDir() {
+			h.serveErr(w, os.ErrNotExist)
+			return
+		}
+
+		defer f.Close()
+	}
+
+	hash, err := h.hash(p, f)
+	if err != nil {
+		h.serveErr(w, err)
+		return
+	}
+
+	ctype, err := contentType(p, f)
+	if err != nil {
+		h.serveErr(w, err)
+		return
+	}
+
+	hdr := w.Header()
+	hdr.Set("Content-Type", ctype)
+	switch {
+	case h.hashed[p] && r.URL.Path == p:
+		hdr.Set("Cache-Control", "public, max-age=31536000, immutable")
+	case h.cfg.MaxAge > 0:
+		hdr.Set("Cache-Control", "public, max-age="+strconv.Itoa(int(h.cfg.MaxAge.Seconds())))
+	default:
+		hdr.Set("Cache-Control", "no-cache")
+	}
+
+	// ranges are always served from the uncompressed content
+	var content io.ReadSeeker = f
+	var vary bool
+	for _, enc := range h.cfg.Encodings {
+		data := encoded(fi, enc)
+		if data == nil {
+			continue
+		}
+
+		vary = true
+		if r.Header.Get("Range") == "" && acceptsEncoding(r, enc) {
+			hdr.Set("Content-Encoding", enc)
+			content, hash = bytes.NewReader(data), hash+"-"+enc
+			break
+		}
+	}
+
+	if vary {
+		hdr.Add("Vary", "Accept-Encoding")
+	}
+
+	// ServeContent takes care of If-None-Match, Range and HEAD requests
+	hdr.Set("ETag", `"`+hash+`"`)
+	http.ServeContent(w, r, p, fi.ModTime(), content)
+}
+
+// open the file at 'p' and stat it
+func (h *Handler) open(p string) (f http.File, fi os.FileInfo, err error) {
+	f, err = h.fs.Open(p)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fi, err = f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	return
+}
+
+// hash returns the hash of the uncompressed content of the file at 'p', since
+// the filesystem is embedded it only has to be calculated once.
+func (h *Handler) hash(p string, f http.File) (hash string, err error) {
+	h.mu.Lock()
+	hash, ok := h.hashes[p]
+	h.mu.Unlock()
+	if ok {
+		return hash, nil
+	}
+
+	sum := sha256.New()
+	_, err = io.Copy(sum, f)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash '%s': %w", p, err)
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", fmt.Errorf("failed to rewind '%s': %w", p, err)
+	}
+
+	hash = hex.EncodeToString(sum.Sum(nil))[:32]
+	h.mu.Lock()
+	h.hashes[p] = hash
+	h.mu.Unlock()
+	return
+}
+
+// serveErr writes the response for an error that occurred while opening a file
+func (h *Handler) serveErr(w http.ResponseWriter, err error) {
+	switch {
+	case os.IsNotExist(err):
+		http.Error(w, "404 page not found", http.StatusNotFound)
+	case os.IsPermission(err):
+		http.Error(w, "403 Forbidden", http.StatusForbidden)
+	default:
+		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// contentType determines the content type of the file from its extension, or
+// else by sniffing its (uncompressed) content.
+func contentType(p string, f http.File) (ctype string, err error) {
+	ctype = mime.TypeByExtension(path.Ext(p))
+	if ctype != "" {
+		return ctype, nil
+	}
+
+	var buf [512]byte
+	n, _ := io.ReadFull(f, buf[:])
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", fmt.Errorf("failed to rewind '%s': %w", p, err)
+	}
+
+	return http.DetectContentType(buf[:n]), nil
+}
+
+// encoded returns the content of a file in content encoding 'enc', or nil if
+// it isn't stored in that encoding
+func encoded(fi os.FileInfo, enc string) []byte {
+	if gz, ok := fi.(gzipper); ok && enc == "gzip" {
+		return gz.GzipBytes()
+	}
+
+	if e, ok := fi.(encoder); ok {
+		return e.EncodedBytes(enc)
+	}
+
+	return nil
+}
+
+// acceptsEncoding reports whether the client accepts the content encoding
+func acceptsEncoding(r *http.Request, enc string) bool {
+	for _, v := range r.Header["Accept-Encoding"] {
+		for _, part := range strings.Split(v, ",") {
+			name, params := part, ""
+			if i := strings.Index(part, ";"); i >= 0 {
+				name, params = part[:i], part[i+1:]
+			}
+
+			if !strings.EqualFold(strings.TrimSpace(name), enc) {
+				continue
+			}
+
+			// an explicit q=0 means the encoding is not acceptable
+			params = strings.ReplaceAll(params, " ", "")
+			q, err := strconv.ParseFloat(strings.TrimPrefix(params, "q="), 64)
+			return params == "" || err != nil || q > 0
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,181 @@
+package fileserver_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wirebase/wire/fileserver"
+)
+
+// gzipFS provides gzip compressed bytes for its files, like the embedded
+// filesystem does
+type gzipFS struct{ http.Dir }
+
+func (fs gzipFS) Open(name string) (http.File, error) {
+	f, err := fs.Dir.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return gzipFile{f}, nil
+}
+
+type gzipFile struct{ http.File }
+
+func (f gzipFile) Stat() (os.FileInfo, error) {
+	fi, err := f.File.Stat()
+	if err != nil || fi.IsDir() {
+		return fi, err
+	}
+
+	data, _ := ioutil.ReadAll(f.File)
+	f.File.Seek(0, 0)
+
+	buf := bytes.NewBuffer(nil)
+	gw := gzip.NewWriter(buf)
+	gw.Write(data)
+	gw.Close()
+	return gzipInfo{fi, buf.Bytes()}, nil
+}
+
+type gzipInfo struct {
+	os.FileInfo
+	gz []byte
+}
+
+func (fi gzipInfo) GzipBytes() []byte { return fi.gz }
+
+// EncodedBytes pretends the file is stored in "br", which is the gzip content
+// with a marker in front.
+func (fi gzipInfo) EncodedBytes(name string) []byte {
+	if name != "br" {
+		return nil
+	}
+
+	return append([]byte("br:"), fi.gz...)
+}
+
+func TestFileServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fileserver_test_")
+	if err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+
+	defer os.RemoveAll(dir)
+	content := strings.Repeat("console.log('hello');", 10)
+	os.MkdirAll(filepath.Join(dir, "docs"), 0777)
+	ioutil.WriteFile(filepath.Join(dir, "app.js"), []byte(content), 0666)
+	ioutil.WriteFile(filepath.Join(dir, "app.0123456789abcdef.js"), []byte(content), 0666)
+	ioutil.WriteFile(filepath.Join(dir, "docs", "index.html"), []byte("<html></html>"), 0666)
+
+	h := fileserver.New(gzipFS{http.Dir(dir)}, fileserver.Config{
+		Manifest: map[string]string{"/main.js": "/app.0123456789abcdef.js"},
+	})
+
+	get := func(p string, hdrs ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", p, nil)
+		for i := 0; i < len(hdrs); i += 2 {
+			req.Header.Set(hdrs[i], hdrs[i+1])
+		}
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/app.js")
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || rec.Body.String() != content {
+		t.Fatalf("expected content to be served, got: %d %s", rec.Code, rec.Body.String())
+	}
+
+	if !strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, `W/`) {
+		t.Fatalf("expected strong etag, got: %v", etag)
+	}
+
+	if cc := rec.Header().Get("Cache-Control"); cc != "no-cache" {
+		t.Fatalf("expected asset to be revalidated, got: %v", cc)
+	}
+
+	t.Run("not modified", func(t *testing.T) {
+		rec := get("/app.js", "If-None-Match", etag)
+		if rec.Code != http.StatusNotModified {
+			t.Fatalf("expected not modified, got: %d", rec.Code)
+		}
+	})
+
+	t.Run("gzip", func(t *testing.T) {
+		rec := get("/app.js", "Accept-Encoding", "deflate, gzip;q=0.8")
+		if rec.Header().Get("Content-Encoding") != "gzip" || rec.Header().Get("ETag") == etag {
+			t.Fatalf("expected gzip with its own etag, got: %v", rec.Header())
+		}
+
+		gr, err := gzip.NewReader(rec.Body)
+		if err != nil {
+			t.Fatalf("expected gzip body, got: %v", err)
+		}
+
+		data, _ := ioutil.ReadAll(gr)
+		if string(data) != content {
+			t.Fatalf("expected gzip body to decompress to content, got: %s", data)
+		}
+
+		rec = get("/app.js", "Accept-Encoding", "gzip;q=0")
+		if rec.Header().Get("Content-Encoding") != "" {
+			t.Fatalf("expected gzip to be refused")
+		}
+	})
+
+	t.Run("brotli", func(t *testing.T) {
+		rec := get("/app.js", "Accept-Encoding", "gzip, deflate, br")
+		if rec.Header().Get("Content-Encoding") != "br" || !strings.HasPrefix(rec.Body.String(), "br:") {
+			t.Fatalf("expected brotli to be preferred, got: %v", rec.Header())
+		}
+
+		if etag := rec.Header().Get("ETag"); !strings.HasSuffix(etag, `-br"`) {
+			t.Fatalf("expected etag for the encoding, got: %v", etag)
+		}
+	})
+
+	t.Run("range", func(t *testing.T) {
+		rec := get("/app.js", "Range", "bytes=0-6", "Accept-Encoding", "gzip")
+		if rec.Code != http.StatusPartialContent || rec.Body.String() != "console" {
+			t.Fatalf("expected partial content, got: %d %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("fingerprinted", func(t *testing.T) {
+		rec := get("/app.0123456789abcdef.js")
+		if cc := rec.Header().Get("Cache-Control"); !strings.Contains(cc, "immutable") {
+			t.Fatalf("expected fingerprinted asset to be cached indefinitely, got: %v", cc)
+		}
+
+		rec = get("/main.js")
+		if rec.Body.String() != content || rec.Header().Get("Cache-Control") != "no-cache" {
+			t.Fatalf("expected logical path to be served and revalidated, got: %v", rec.Header())
+		}
+	})
+
+	t.Run("index and missing", func(t *testing.T) {
+		rec := get("/docs/")
+		if rec.Body.String() != "<html></html>" || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+			t.Fatalf("expected index to be served, got: %d %s", rec.Code, rec.Body.String())
+		}
+
+		rec = get("/docs?v=1")
+		if loc := rec.Header().Get("Location"); rec.Code != http.StatusMovedPermanently || loc != "docs/?v=1" {
+			t.Fatalf("expected redirect to the directory, got: %d %s", rec.Code, loc)
+		}
+
+		if rec = get("/nope.js"); rec.Code != http.StatusNotFound {
+			t.Fatalf("expected not found, got: %d", rec.Code)
+		}
+	})
+}
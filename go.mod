@@ -1,3 +1,3 @@
 module github.com/wirebase/wire
 
-go 1.13
+go 1.16
@@ -2,18 +2,121 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"runtime/debug"
 	"time"
 
 	"github.com/wirebase/wire/project"
 )
 
+// version is set at build time with: -ldflags "-X main.version=v1.2.3"
+var version = "dev"
+
+// usage is shown when the command is called incorrectly or with 'help'
+const usage = `usage: wire <command> [flags]
+
+Commands:
+  dev      bundle, build and run the project on every change (default)
+  build    bundle the frontend and build the serving binary, without running it
+  bundle   only bundle the frontend and write the embed file
+  clean    remove the embed file and leftover serving binaries
+  version  print the version of wire
+
+Run 'wire <command> -h' for the flags of each command.
+`
+
 func main() {
-	wd, err := os.Getwd()
+	log.SetFlags(0)
+	log.SetPrefix("wire: ")
+
+	cmd, args := "dev", os.Args[1:]
+	if len(args) > 0 && len(args[0]) > 0 && args[0][0] != '-' {
+		cmd, args = args[0], args[1:]
+	}
+
+	var err error
+	switch cmd {
+	case "dev":
+		err = runDev(args)
+	case "build":
+		err = runBuild(args)
+	case "bundle":
+		err = runBundle(args)
+	case "clean":
+		err = runClean(args)
+	case "version":
+		fmt.Println(readVersion())
+	case "help":
+		fmt.Fprint(os.Stdout, usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command '%s'\n\n%s", cmd, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		log.Fatalf("%s: %v", cmd, err)
+	}
+}
+
+// projectFlags are the flags shared by all commands that operate on a project
+type projectFlags struct {
+	dir     string
+	cfgp    string
+	verbose bool
+}
+
+// parseProjectFlags registers the project flags on 'fs', parses 'args' and
+// creates the project from it.
+func parseProjectFlags(fs *flag.FlagSet, args []string, pollf *time.Duration) (prj *project.Project, err error) {
+	var pf projectFlags
+	fs.StringVar(&pf.dir, "dir", "", "project directory, defaults to the working directory")
+	fs.StringVar(&pf.cfgp, "config", "", "config file, defaults to '"+project.ConfigFilename+"' in the project directory")
+	fs.BoolVar(&pf.verbose, "v", false, "show every step of the building process")
+	err = fs.Parse(args)
 	if err != nil {
-		log.Fatalf("failed to get working dir: %v", err)
+		return nil, err
+	}
+
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+
+	if pf.dir == "" {
+		pf.dir, err = os.Getwd()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get working dir: %w", err)
+		}
+	}
+
+	pf.dir, err = filepath.Abs(pf.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine project dir: %w", err)
+	}
+
+	var ui project.UI = project.NewTerseTerminal(os.Stderr)
+	if pf.verbose {
+		ui = project.NewVerboseTerminal(os.Stderr)
+	}
+
+	var f time.Duration
+	if pollf != nil {
+		f = *pollf
+	}
+
+	return project.New(pf.dir, pf.cfgp, f, ui), nil
+}
+
+func runDev(args []string) (err error) {
+	fs := flag.NewFlagSet("dev", flag.ExitOnError)
+	pollf := fs.Duration("poll", time.Millisecond*500, "interval at which the project directory is scanned for changes")
+	prj, err := parseProjectFlags(fs, args, pollf)
+	if err != nil {
+		return err
 	}
 
 	ctx := context.Background()
@@ -22,13 +125,65 @@ func main() {
 
 	go handleInterrupt(cancel)
 
-	prj := project.New(wd, time.Millisecond*500)
 	err = prj.Run(ctx)
 	if err != nil {
-		log.Fatalf("failed to run development server: %v", err)
+		return fmt.Errorf("failed to run development server: %w", err)
 	}
 
 	println("shutting down")
+	return nil
+}
+
+func runBuild(args []string) (err error) {
+	fs := flag.NewFlagSet("build", flag.ExitOnError)
+	o := fs.String("o", "", "output path of the serving binary, defaults to the project directory name")
+	prj, err := parseProjectFlags(fs, args, nil)
+	if err != nil {
+		return err
+	}
+
+	if *o == "" {
+		*o = filepath.Base(prj.Dir())
+	}
+
+	*o, err = filepath.Abs(*o)
+	if err != nil {
+		return fmt.Errorf("failed to determine output path: %w", err)
+	}
+
+	return prj.Build(*o)
+}
+
+func runBundle(args []string) (err error) {
+	prj, err := parseProjectFlags(flag.NewFlagSet("bundle", flag.ExitOnError), args, nil)
+	if err != nil {
+		return err
+	}
+
+	return prj.Bundle()
+}
+
+func runClean(args []string) (err error) {
+	prj, err := parseProjectFlags(flag.NewFlagSet("clean", flag.ExitOnError), args, nil)
+	if err != nil {
+		return err
+	}
+
+	return prj.Clean()
+}
+
+// readVersion returns the version set at build time or, when installed with
+// 'go install', the version of the module
+func readVersion() string {
+	if version != "dev" {
+		return version
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+		return bi.Main.Version
+	}
+
+	return version
 }
 
 // handleInterrupt will watch for signals and call cancel if an interrupt signal was
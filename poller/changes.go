@@ -0,0 +1,133 @@
+package poller
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Changes describes what changed in the directory tree between two scans. The
+// paths are relative to the polled directory and sorted. Directories are only
+// reported when they are created, deleted or renamed, changes to their content
+// are reported for the files in them.
+type Changes struct {
+	Created  []string
+	Modified []string
+	Deleted  []string
+	Renamed  []Rename
+}
+
+// Rename describes a file or directory that was moved within the tree
+type Rename struct {
+	From, To string
+}
+
+// String returns the rename as "from -> to"
+func (r Rename) String() string { return r.From + " -> " + r.To }
+
+// Empty returns whether nothing changed
+func (c Changes) Empty() bool {
+	return len(c.Created)+len(c.Modified)+len(c.Deleted)+len(c.Renamed) == 0
+}
+
+// Paths returns all paths that changed, sorted. For renames both the old and
+// the new path are included.
+func (c Changes) Paths() (paths []string) {
+	paths = append(paths, c.Created...)
+	paths = append(paths, c.Modified...)
+	paths = append(paths, c.Deleted...)
+	for _, r := range c.Renamed {
+		paths = append(paths, r.From, r.To)
+	}
+
+	sort.Strings(paths)
+	return
+}
+
+// String describes the changes for the user, i.e: "modified main.go, app.css"
+func (c Changes) String() string {
+	renamed := make([]string, 0, len(c.Renamed))
+	for _, r := range c.Renamed {
+		renamed = append(renamed, r.String())
+	}
+
+	var parts []string
+	for _, kind := range []struct {
+		name  string
+		paths []string
+	}{{"created", c.Created}, {"modified", c.Modified}, {"deleted", c.Deleted}, {"renamed", renamed}} {
+		switch n := len(kind.paths); {
+		case n == 0:
+			continue
+		case n > 3:
+			parts = append(parts, fmt.Sprintf("%s %s and %d more", kind.name, strings.Join(kind.paths[:3], ", "), n-3))
+		default:
+			parts = append(parts, fmt.Sprintf("%s %s", kind.name, strings.Join(kind.paths, ", ")))
+		}
+	}
+
+	if len(parts) < 1 {
+		return "nothing changed"
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+// entry is the state of a file or directory as found by a scan
+type entry struct {
+	size    int64
+	modTime time.Time
+	mode    os.FileMode
+	inode   uint64 // zero if the platform has no inodes
+}
+
+// newEntry returns the entry for the file info of a scan
+func newEntry(fi os.FileInfo) entry {
+	return entry{size: fi.Size(), modTime: fi.ModTime(), mode: fi.Mode(), inode: inode(fi)}
+}
+
+// modified returns whether the file changed from 'prev' to 'e'. A different
+// inode means it was replaced, as editors do when they save atomically.
+func (e entry) modified(prev entry) bool {
+	return e.size != prev.size || !e.modTime.Equal(prev.modTime) || e.mode != prev.mode || e.inode != prev.inode
+}
+
+// renames pairs up deleted and created paths of the same inode, such that it
+// doesn't matter which mod time a moved file has. Files must also have the same
+// size in case the inode was reused. The entries of the deleted paths are in
+// 'prev', those of the created paths in 'cur'. It returns the paths that remain
+// created and deleted.
+func renames(prev, cur map[string]entry, created, deleted []string) (nc, nd []string, rs []Rename) {
+	from := map[uint64]string{}
+	for _, rel := range deleted {
+		if ino := prev[rel].inode; ino != 0 {
+			from[ino] = rel
+		}
+	}
+
+	renamed := map[string]bool{}
+	for _, rel := range created {
+		e := cur[rel]
+		old, ok := from[e.inode]
+		pe := prev[old]
+		if !ok || e.inode == 0 || pe.mode.IsDir() != e.mode.IsDir() || (!e.mode.IsDir() && pe.size != e.size) {
+			nc = append(nc, rel)
+			continue
+		}
+
+		rs = append(rs, Rename{From: old, To: rel})
+		renamed[old] = true
+		delete(from, e.inode)
+	}
+
+	for _, rel := range deleted {
+		if !renamed[rel] {
+			nd = append(nd, rel)
+		}
+	}
+
+	sort.Slice(rs, func(i, j int) bool { return rs[i].To < rs[j].To })
+	return
+}
@@ -0,0 +1,7 @@
+package poller
+
+import "os"
+
+// inode returns zero, file infos on windows don't provide a file index such
+// that renames are reported as a deletion and a creation
+func inode(fi os.FileInfo) uint64 { return 0 }
@@ -2,9 +2,9 @@ package poller
 
 import (
 	"context"
-	"errors"
-	"os"
 	"path/filepath"
+	"reflect"
+	"sync/atomic"
 	"time"
 )
 
@@ -15,31 +15,121 @@ type Config struct {
 	// pattern it will be ignored during a scan. If it matches a directory
 	// all files in the directory will be ignored
 	Ignore []string
+
+	// Watch will have the operating system notify the poller of changes, such
+	// that the directory is only scanned when something changed instead of on
+	// every interval. It falls back to scanning on the interval if the platform
+	// doesn't support it or the tree has more directories than can be watched.
+	Watch bool
+
+	// MinInterval is the time between scans right after a change was found.
+	// Defaults to the interval the poller was created with.
+	MinInterval time.Duration
+
+	// MaxInterval is the longest time between scans the interval may back off
+	// to. If it is less than MinInterval, MinInterval is used such that the
+	// interval doesn't change.
+	MaxInterval time.Duration
+
+	// ColdCycles is the number of cycles after which a directory without recent
+	// changes is scanned again, directories with many entries are scanned four
+	// times less often. Directories with recent changes are scanned on every
+	// cycle, before all others. Only applies once scanning the whole tree takes
+	// a real share of the interval, smaller trees are scanned completely on
+	// every cycle. Defaults to 4.
+	ColdCycles int
+
+	// Backoff is the factor by which the interval grows after every scan that
+	// found nothing, until it reaches MaxInterval. Values of 1 or less keep the
+	// interval at MinInterval.
+	Backoff float64
+}
+
+// coldCycles returns the configured cold cycles or the default
+func (cfg Config) coldCycles() int {
+	if cfg.ColdCycles < 1 {
+		return 4
+	}
+
+	return cfg.ColdCycles
 }
 
-// A Poller will scan a directory for changes by repeatedly checking the
-// modification time of any directory or file has changed.
+// maxScanShare is the largest fraction of the interval that a scan may take,
+// if scanning takes longer the interval is stretched beyond MaxInterval such
+// that large trees don't keep the cpu busy
+const maxScanShare = 0.25
+
+// interval returns the time to wait until the next scan, based on the current
+// interval 'cur', whether the last scan found a change and how long it took.
+func (cfg Config) interval(base, cur time.Duration, changed bool, took time.Duration) (d time.Duration) {
+	min, max := cfg.MinInterval, cfg.MaxInterval
+	if min <= 0 {
+		min = base
+	}
+
+	if max < min {
+		max = min
+	}
+
+	d = min
+	if !changed && cfg.Backoff > 1 {
+		d = time.Duration(float64(cur) * cfg.Backoff)
+	}
+
+	if d < min {
+		d = min
+	} else if d > max {
+		d = max
+	}
+
+	if stretched := time.Duration(float64(took) / maxScanShare); d < stretched {
+		d = stretched
+	}
+
+	return
+}
+
+// watchSettle is how long the poller waits for more events before it scans
+const watchSettle = time.Millisecond * 5
+
+// A Poller will scan a directory for changes by repeatedly comparing the size,
+// modification time, mode and inode of files and directories with those of the
+// previous scan. Directories with recent changes are scanned on every cycle,
+// others only every few cycles such that changes in large trees are found
+// sooner.
 type Poller struct {
+	ival int64 // current interval, accessed atomically so it is kept 64-bit aligned
+
 	ctx  context.Context
-	mods chan time.Time
+	mods chan Changes
 	errs chan error
 	last error
+	chgs Changes
 	freq time.Duration
 	dir  string
 	cfgs chan Config
+
+	// only used by the polling goroutine
+	tree        *tree
+	watcher     Watcher
+	watchIgnore []string // the ignore patterns the watcher was started with
+	unwatchable bool
 }
 
 // New will create and start a new poller that scans the directory tree 'dir'
-// every 'f' amount of time. Changes can be observed by using the poller as an
-// iterator, iteration stops when the provided ctx is cancelled
+// every 'f' amount of time, unless configured otherwise. Changes can be
+// observed by using the poller as an iterator, iteration stops when the
+// provided ctx is cancelled
 func New(ctx context.Context, dir string, f time.Duration) (p *Poller) {
 	p = &Poller{
 		ctx:  ctx,
-		mods: make(chan time.Time, 0),
+		mods: make(chan Changes, 0),
 		errs: make(chan error),
 		cfgs: make(chan Config, 1),
 		freq: f,
+		ival: int64(f),
 		dir:  dir,
+		tree: newTree(dir),
 	}
 
 	p.cfgs <- Config{}
@@ -51,99 +141,182 @@ func New(ctx context.Context, dir string, f time.Duration) (p *Poller) {
 // Next blocks until a new change has been detected
 func (p *Poller) Next() bool {
 	select {
-	case mt := <-p.mods:
-		if mt.IsZero() {
+	case c, ok := <-p.mods:
+		if !ok {
 			return false
 		}
 
+		p.chgs = c
 		return true
 	case err := <-p.errs:
-		p.last = err
+		p.last, p.chgs = err, Changes{}
 		return true
 	}
 }
 
+// Changes returns what changed since the previous change, as detected by the
+// last call to Next. It is empty if Next returned because of an error.
+func (p *Poller) Changes() Changes {
+	return p.chgs
+}
+
 // Update the poller configuration, overwriting it on the next polling cycle
 func (p *Poller) Update(cfg Config) {
 	p.cfgs <- cfg
 }
 
+// Interval returns the current time between scans, which grows while nothing
+// changes if the poller is configured to back off. While the poller is watching
+// it only scans when notified of a change.
+func (p *Poller) Interval() time.Duration {
+	return time.Duration(atomic.LoadInt64(&p.ival))
+}
+
 // Err returns the last error that occured
 func (p *Poller) Err() error {
 	return p.last
 }
 
 // repeatedly scan directory 'dir' for changed files or directories, if something
-// has changed a signal is send over 'c'. It will then wait for 'w' amount of time
-// before performing a new scan. It will close 'c' if the context is cancelled.
+// has changed a signal is send over 'c'. It will then wait for 'w' amount of time,
+// or until the watcher reports a change, before performing a new scan. It will
+// close 'c' if the context is cancelled.
 func (p *Poller) start() {
-	for t := time.Now(); ; {
+	defer p.unwatch(false)
+	for {
 
 		// read the lastest config, this is always available
 		cfg := <-p.cfgs
 
-		nt, err := p.scan(t, cfg)
-		if err != nil {
-			p.errs <- err
-		} else if !nt.IsZero() {
-			p.mods <- nt
-			t = nt
+		// start or stop watching as configured, once watching failed the
+		// poller keeps on scanning on the interval. Ignored directories are
+		// not watched, so the watcher is replaced when the patterns change.
+		if cfg.Watch && p.watcher != nil && !reflect.DeepEqual(p.watchIgnore, cfg.Ignore) {
+			p.unwatch(false)
+			p.tree.mark(".") // events may have been missed in between
 		}
 
-		select {
-		case <-time.After(p.freq):
-
-			// try to push the current config back to read on the next iteration. If
-			// thats blocks it means new config was pushed and has precedence
-			select {
-			case p.cfgs <- cfg:
-			default:
+		if cfg.Watch && p.watcher == nil && !p.unwatchable {
+			var err error
+			p.watcher, err = NewWatcher(p.dir, cfg.Ignore...)
+			if err != nil {
+				p.watcher, p.unwatchable = nil, true
 			}
 
-			continue
-		case <-p.ctx.Done():
+			p.watchIgnore = cfg.Ignore
+		} else if !cfg.Watch {
+			p.unwatch(false)
+		}
+
+		// the first scan only establishes what is there, the interval is
+		// updated before the change is reported such that it can be observed
+		start := time.Now()
+		c, err := p.tree.scan(cfg, cfg.coldCycles(), p.Interval())
+		p.setInterval(cfg.interval(p.freq, p.Interval(), !c.Empty(), time.Since(start)))
+		if !c.Empty() {
+			p.mods <- c
+		}
+
+		if err != nil {
+			p.errs <- err
+		}
+
+		cfg, ok := p.wait(cfg)
+		if !ok {
 			close(p.mods)
 			return
 		}
+
+		// try to push the current config back to read on the next iteration. If
+		// thats blocks it means new config was pushed and has precedence
+		select {
+		case p.cfgs <- cfg:
+		default:
+		}
 	}
 }
 
-// scan for a file or directory that has a newer mod date then 't' and
-// return this newer time. If no newer time was found, it returns a zero time.
-func (p *Poller) scan(t time.Time, cfg Config) (nt time.Time, err error) {
-	stop := errors.New("stop")
-	err = filepath.Walk(p.dir, func(path string, fi os.FileInfo, err error) error {
-		if err != nil {
-			return err // stop the walk on any error
-		}
+// wait until the next scan is due. That is after the polling interval or, when
+// watching, after the watcher reported a change to a file that is not ignored.
+// A config update is applied right away, it returns false if the context is
+// cancelled.
+func (p *Poller) wait(cfg Config) (Config, bool) {
+	var tick <-chan time.Time
+	var events <-chan string
+	var errs <-chan error
+	if p.watcher != nil {
+		events, errs = p.watcher.Events(), p.watcher.Errors()
+	} else {
+		tick = time.After(p.Interval())
+	}
 
-		// if the file or directory matches an ignore pattern, skip it
-		rel, _ := filepath.Rel(p.dir, path)
-		for _, pattern := range cfg.Ignore {
-			m, _ := filepath.Match(pattern, rel)
-			if !m {
-				continue
+	for {
+		select {
+		case <-tick:
+			return cfg, true
+		case path, ok := <-events:
+			if !ok {
+				p.unwatch(true)
+				return cfg, true
 			}
 
-			if fi.IsDir() {
-				return filepath.SkipDir
+			// writing ignored files, such as the embed file, shouldn't cause a scan
+			rel, _ := filepath.Rel(p.dir, path)
+			if ignored(rel, cfg.Ignore) {
+				continue
 			}
 
-			return nil //skip just this file
+			// a single write may cause several events, let them settle
+			// such that they are handled by a single scan
+			p.tree.mark(rel)
+			p.settle(events, watchSettle)
+			return cfg, true
+		case <-errs:
+			p.unwatch(true) // scanning is reliable, watching may miss changes now
+			return cfg, true
+		case cfg = <-p.cfgs:
+			return cfg, true
+		case <-p.ctx.Done():
+			return cfg, false
 		}
+	}
+}
+
+// settle marks the directories of events to be scanned until none arrived for
+// duration 'd', or for at most the current interval if they keep on coming
+func (p *Poller) settle(events <-chan string, d time.Duration) {
+	max := time.After(p.Interval())
+	for {
+		select {
+		case path, ok := <-events:
+			if !ok {
+				return
+			}
 
-		// if we found any file that is newer, then our last scan we're done
-		if fi.ModTime().After(t) {
-			nt = fi.ModTime()
-			return stop
+			rel, _ := filepath.Rel(p.dir, path)
+			p.tree.mark(rel)
+		case <-time.After(d):
+			return
+		case <-max:
+			return
 		}
+	}
+}
 
-		return nil
-	})
+// setInterval sets the current interval
+func (p *Poller) setInterval(d time.Duration) {
+	atomic.StoreInt64(&p.ival, int64(d))
+}
 
-	if err == nil || err == stop {
-		return nt, nil
+// unwatch closes the watcher, if it failed the poller won't watch again
+func (p *Poller) unwatch(failed bool) {
+	if p.watcher != nil {
+		p.watcher.Close()
+		p.watcher = nil
 	}
 
-	return
+	if failed {
+		p.unwatchable = true
+		p.tree.mark(".") // events may have been lost
+	}
 }
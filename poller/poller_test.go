@@ -5,6 +5,8 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strconv"
 	"testing"
 	"time"
@@ -50,6 +52,329 @@ func TestPollFileCreation(t *testing.T) {
 	}
 }
 
+func TestPollChanges(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "tl_poller_")
+	if err != nil {
+		t.Fatalf("failed to create tempdir: %v", err)
+	}
+
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "a.txt"), nil, 0777)
+	os.MkdirAll(filepath.Join(dir, "x"), 0777)
+	ioutil.WriteFile(filepath.Join(dir, "x", "y.txt"), nil, 0777)
+
+	p := poller.New(ctx, dir, time.Millisecond*10)
+	go func() {
+		time.Sleep(time.Millisecond * 20)
+		ioutil.WriteFile(filepath.Join(dir, "new.txt"), nil, 0777)
+		os.Chtimes(filepath.Join(dir, "a.txt"), time.Now(), time.Now().Add(-time.Hour))
+		os.RemoveAll(filepath.Join(dir, "x"))
+	}()
+
+	var all poller.Changes
+	for len(all.Created) < 1 || len(all.Modified) < 1 || len(all.Deleted) < 2 {
+		if !p.Next() {
+			t.Fatalf("expected all changes to be detected, got: %v", all)
+		}
+
+		c := p.Changes()
+		all.Created = append(all.Created, c.Created...)
+		all.Modified = append(all.Modified, c.Modified...)
+		all.Deleted = append(all.Deleted, c.Deleted...)
+	}
+
+	exp := poller.Changes{
+		Created:  []string{"new.txt"},
+		Modified: []string{"a.txt"},
+		Deleted:  []string{"x", filepath.Join("x", "y.txt")},
+	}
+
+	if !reflect.DeepEqual(all, exp) {
+		t.Fatalf("expected changes: %v, got: %v", exp, all)
+	}
+
+	if s := exp.String(); s != "created new.txt; modified a.txt; deleted x, "+filepath.Join("x", "y.txt") {
+		t.Fatalf("expected changes to be described, got: %s", s)
+	}
+}
+
+func TestPollSnapshot(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "tl_poller_")
+	if err != nil {
+		t.Fatalf("failed to create tempdir: %v", err)
+	}
+
+	defer os.RemoveAll(dir)
+	other, err := ioutil.TempDir("", "tl_poller_")
+	if err != nil {
+		t.Fatalf("failed to create tempdir: %v", err)
+	}
+
+	defer os.RemoveAll(other)
+
+	// all mod times are in the past, such that none of the changes make them newer
+	old := time.Now().Add(-time.Hour)
+	for _, p := range []string{filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt"), filepath.Join(other, "c.txt")} {
+		ioutil.WriteFile(p, []byte("hello"), 0777)
+		os.Chtimes(p, old, old)
+	}
+
+	os.Chtimes(dir, old, old)
+	p := poller.New(ctx, dir, time.Millisecond*10)
+	go func() {
+		time.Sleep(time.Millisecond * 20)
+		os.Rename(filepath.Join(dir, "a.txt"), filepath.Join(dir, "renamed.txt"))
+		os.Rename(filepath.Join(other, "c.txt"), filepath.Join(dir, "c.txt"))
+		ioutil.WriteFile(filepath.Join(dir, "b.txt"), []byte("hello, world"), 0777)
+		os.Chtimes(filepath.Join(dir, "b.txt"), old, old)
+		os.Chtimes(dir, old, old)
+	}()
+
+	var all poller.Changes
+	for len(all.Created) < 1 || len(all.Modified) < 1 || len(all.Renamed) < 1 {
+		if !p.Next() {
+			t.Fatalf("expected all changes to be detected, got: %v", all)
+		}
+
+		c := p.Changes()
+		all.Created = append(all.Created, c.Created...)
+		all.Modified = append(all.Modified, c.Modified...)
+		all.Deleted = append(all.Deleted, c.Deleted...)
+		all.Renamed = append(all.Renamed, c.Renamed...)
+	}
+
+	exp := poller.Changes{
+		Created:  []string{"c.txt"},
+		Modified: []string{"b.txt"},
+		Renamed:  []poller.Rename{{From: "a.txt", To: "renamed.txt"}},
+	}
+
+	if !reflect.DeepEqual(all, exp) {
+		t.Fatalf("expected changes: %v, got: %v", exp, all)
+	}
+}
+
+func TestPollInterval(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "tl_poller_")
+	if err != nil {
+		t.Fatalf("failed to create tempdir: %v", err)
+	}
+
+	defer os.RemoveAll(dir)
+	p := poller.New(ctx, dir, time.Millisecond*5)
+	p.Update(poller.Config{MaxInterval: time.Millisecond * 40, Backoff: 2})
+
+	// waits until the interval satisfies 'fn'
+	waitFor := func(desc string, fn func(d time.Duration) bool) {
+		for start := time.Now(); !fn(p.Interval()); time.Sleep(time.Millisecond) {
+			if time.Since(start) > time.Second {
+				t.Fatalf("expected interval to %s, got: %s", desc, p.Interval())
+			}
+		}
+	}
+
+	waitFor("back off to the max", func(d time.Duration) bool { return d == time.Millisecond*40 })
+
+	ioutil.WriteFile(filepath.Join(dir, "foo.txt"), nil, 0777)
+	if !p.Next() || p.Err() != nil {
+		t.Fatalf("expected change to be detected, got: %v", p.Err())
+	}
+
+	if d := p.Interval(); d >= time.Millisecond*40 {
+		t.Fatalf("expected interval to be reset after a change, got: %s", d)
+	}
+
+	// scanning many files takes longer than a tiny share of the interval
+	for i := 0; i < 2000; i++ {
+		ioutil.WriteFile(filepath.Join(dir, strconv.Itoa(i)+".txt"), nil, 0777)
+	}
+
+	go func() {
+		for p.Next() {
+		}
+	}()
+
+	p.Update(poller.Config{MinInterval: time.Microsecond, MaxInterval: time.Microsecond})
+	waitFor("stretch with the scan time", func(d time.Duration) bool { return d > time.Microsecond*100 })
+}
+
+func TestPollWatchHotAndCold(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "tl_poller_")
+	if err != nil {
+		t.Fatalf("failed to create tempdir: %v", err)
+	}
+
+	defer os.RemoveAll(dir)
+	if w, err := poller.NewWatcher(dir); err == poller.ErrWatchUnsupported {
+		t.Skip("watching is not supported on this platform")
+	} else if err == nil {
+		w.Close()
+	}
+
+	os.Mkdir(filepath.Join(dir, "hot"), 0777)
+	os.Mkdir(filepath.Join(dir, "cold"), 0777)
+
+	// without a scan being due the cold directory is only scanned when it is
+	// known to have changed
+	p := poller.New(ctx, dir, time.Hour)
+	p.Update(poller.Config{Watch: true, ColdCycles: 100})
+	changes := make(chan poller.Changes)
+	go func() {
+		for p.Next() {
+			changes <- p.Changes()
+		}
+	}()
+
+	// waits for the paths to be reported as created, over one or more changes
+	waitFor := func(paths ...string) {
+		var created []string
+		for !reflect.DeepEqual(created, paths) {
+			select {
+			case c := <-changes:
+				created = append(created, c.Created...)
+				sort.Strings(created)
+			case <-time.After(time.Second * 2):
+				t.Fatalf("expected %v to be created, got: %v", paths, created)
+			}
+		}
+	}
+
+	time.Sleep(time.Millisecond * 50)
+	ioutil.WriteFile(filepath.Join(dir, "hot", "a.txt"), nil, 0777)
+	waitFor(filepath.Join("hot", "a.txt"))
+
+	ioutil.WriteFile(filepath.Join(dir, "hot", "b.txt"), nil, 0777)
+	ioutil.WriteFile(filepath.Join(dir, "cold", "c.txt"), nil, 0777)
+	waitFor(filepath.Join("cold", "c.txt"), filepath.Join("hot", "b.txt"))
+}
+
+func TestPollHotDirs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tl_poller_")
+	if err != nil {
+		t.Fatalf("failed to create tempdir: %v", err)
+	}
+
+	defer os.RemoveAll(dir)
+	for i := 0; i < 50; i++ {
+		sub := filepath.Join(dir, "d"+strconv.Itoa(i))
+		os.Mkdir(sub, 0777)
+		for j := 0; j < 100; j++ {
+			ioutil.WriteFile(filepath.Join(sub, strconv.Itoa(j)+".txt"), nil, 0777)
+		}
+	}
+
+	// measures the average time it takes for files that are created in the
+	// same directory to be detected, the interval is governed by the scan time
+	latency := func(name string, cycles int) (avg time.Duration) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+
+		p := poller.New(ctx, dir, time.Millisecond)
+		p.Update(poller.Config{MinInterval: time.Millisecond, MaxInterval: time.Millisecond, ColdCycles: cycles})
+		time.Sleep(time.Millisecond * 100)
+
+		const n = 10
+		for i := 0; i < n; i++ {
+			rel := filepath.Join("d0", name+strconv.Itoa(i)+".txt")
+			start := time.Now()
+			ioutil.WriteFile(filepath.Join(dir, rel), nil, 0777)
+			if !p.Next() || p.Err() != nil {
+				t.Fatalf("expected change to be detected, got: %v", p.Err())
+			}
+
+			if created := p.Changes().Created; !reflect.DeepEqual(created, []string{rel}) {
+				t.Fatalf("expected %s to be created, got: %v", rel, created)
+			}
+
+			avg += time.Since(start) / n
+		}
+
+		// changes in directories that are scanned less often are still found
+		rel := filepath.Join("d49", name+".txt")
+		ioutil.WriteFile(filepath.Join(dir, rel), nil, 0777)
+		if !p.Next() || p.Err() != nil {
+			t.Fatalf("expected change to be detected, got: %v", p.Err())
+		}
+
+		if created := p.Changes().Created; !reflect.DeepEqual(created, []string{rel}) {
+			t.Fatalf("expected %s to be created, got: %v", rel, created)
+		}
+
+		return
+	}
+
+	all, hot := latency("all", 1), latency("hot", 0)
+	if hot >= all {
+		t.Fatalf("expected hot directories to be detected faster than %s, got: %s", all, hot)
+	}
+}
+
+func TestPollQuietDirs(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "tl_poller_")
+	if err != nil {
+		t.Fatalf("failed to create tempdir: %v", err)
+	}
+
+	defer os.RemoveAll(dir)
+	for i := 0; i < 8; i++ {
+		os.Mkdir(filepath.Join(dir, "d"+strconv.Itoa(i)), 0777)
+	}
+
+	// with the interval of the project defaults backed off to the max, a change
+	// in any of the directories is found within about one interval
+	max := time.Second * 2
+	p := poller.New(ctx, dir, time.Millisecond*500)
+	p.Update(poller.Config{MaxInterval: max, Backoff: 1.5})
+	for start := time.Now(); p.Interval() != max; time.Sleep(time.Millisecond * 10) {
+		if time.Since(start) > time.Second*10 {
+			t.Fatalf("expected interval to back off to %s, got: %s", max, p.Interval())
+		}
+	}
+
+	var exp []string
+	for i := 0; i < 8; i++ {
+		exp = append(exp, filepath.Join("d"+strconv.Itoa(i), "a.txt"))
+	}
+
+	start := time.Now()
+	for _, rel := range exp {
+		ioutil.WriteFile(filepath.Join(dir, rel), nil, 0777)
+	}
+
+	var created []string
+	for len(created) < len(exp) && p.Next() {
+		if p.Err() != nil {
+			t.Fatalf("expected change to be detected, got: %v", p.Err())
+		}
+
+		created = append(created, p.Changes().Created...)
+	}
+
+	sort.Strings(created)
+	if !reflect.DeepEqual(created, exp) {
+		t.Fatalf("expected %v to be created, got: %v", exp, created)
+	}
+
+	if took := time.Since(start); took > max+time.Millisecond*500 {
+		t.Fatalf("expected changes to be found within %s, took: %s", max, took)
+	}
+}
+
 func TestPollOfNonExistingDir(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
 	defer cancel()
@@ -64,3 +389,100 @@ func TestPollOfNonExistingDir(t *testing.T) {
 		t.Fatalf("expected error to be a non-exist error, got: %v", p.Err())
 	}
 }
+
+func TestWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tl_poller_")
+	if err != nil {
+		t.Fatalf("failed to create tempdir: %v", err)
+	}
+
+	defer os.RemoveAll(dir)
+	w, err := poller.NewWatcher(dir)
+	if err == poller.ErrWatchUnsupported {
+		t.Skip("watching is not supported on this platform")
+	} else if err != nil {
+		t.Fatalf("failed to create watcher: %v", err)
+	}
+
+	defer w.Close()
+
+	// directories that are created later are watched as well, once the event
+	// for a directory is received all directories in it are watched
+	os.MkdirAll(filepath.Join(dir, "x", "y"), 0777)
+	for seen := map[string]bool{}; !seen[filepath.Join(dir, "x", "y", "z.txt")]; {
+		select {
+		case p := <-w.Events():
+			seen[p] = true
+			if p == filepath.Join(dir, "x") {
+				ioutil.WriteFile(filepath.Join(dir, "x", "y", "z.txt"), nil, 0777)
+			}
+		case err := <-w.Errors():
+			t.Fatalf("expected no error, got: %v", err)
+		case <-time.After(time.Second):
+			t.Fatalf("expected event for file in new directory, got: %v", seen)
+		}
+	}
+
+	w.Close()
+	for range w.Events() {
+	}
+
+	// ignored directories are not watched, also when they're created later
+	os.MkdirAll(filepath.Join(dir, "node_modules", "pkg"), 0777)
+	w, err = poller.NewWatcher(dir, "node_modules", "*.tmp")
+	if err != nil {
+		t.Fatalf("failed to create watcher: %v", err)
+	}
+
+	defer w.Close()
+	ioutil.WriteFile(filepath.Join(dir, "node_modules", "pkg", "index.js"), nil, 0777)
+	os.MkdirAll(filepath.Join(dir, "x.tmp", "y"), 0777)
+	ioutil.WriteFile(filepath.Join(dir, "x.tmp", "y", "z.txt"), nil, 0777)
+	ioutil.WriteFile(filepath.Join(dir, "a.txt"), nil, 0777)
+	select {
+	case p := <-w.Events():
+		if p != filepath.Join(dir, "a.txt") {
+			t.Fatalf("expected only event for file that isn't ignored, got: %s", p)
+		}
+	case err := <-w.Errors():
+		t.Fatalf("expected no error, got: %v", err)
+	case <-time.After(time.Second):
+		t.Fatalf("expected event for file that isn't ignored")
+	}
+}
+
+func TestPollWatch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "tl_poller_")
+	if err != nil {
+		t.Fatalf("failed to create tempdir: %v", err)
+	}
+
+	defer os.RemoveAll(dir)
+	if w, err := poller.NewWatcher(dir); err == poller.ErrWatchUnsupported {
+		t.Skip("watching is not supported on this platform")
+	} else if err == nil {
+		w.Close()
+	}
+
+	// without the watcher the change would only be found after an hour
+	p := poller.New(ctx, dir, time.Hour)
+	p.Update(poller.Config{Watch: true, Ignore: []string{"bundle.go"}})
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		ioutil.WriteFile(filepath.Join(dir, "bundle.go"), nil, 0777)
+		time.Sleep(time.Millisecond * 50)
+		ioutil.WriteFile(filepath.Join(dir, "foo.txt"), nil, 0777)
+	}()
+
+	start := time.Now()
+	if !p.Next() || p.Err() != nil {
+		t.Fatalf("expected change to be detected, got: %v", p.Err())
+	}
+
+	if d := time.Since(start); d < time.Millisecond*100 {
+		t.Fatalf("expected ignored file to not be detected, got change after: %s", d)
+	}
+}
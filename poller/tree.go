@@ -0,0 +1,314 @@
+package poller
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"time"
+)
+
+const (
+	// heatDecay is the factor by which the heat of a directory decreases on
+	// every scan of it that found no changes
+	heatDecay = 0.8
+
+	// hotHeat is the heat above which a directory is scanned every cycle
+	hotHeat = 0.1
+
+	// largeDir is the number of entries above which a cold directory is scanned
+	// four times less often than other cold directories
+	largeDir = 512
+
+	// coldShare is the fraction of the interval that scanning the whole tree
+	// has to take before cold directories are scanned less often, below it
+	// scanning everything is cheap and changes anywhere are found right away
+	coldShare = 0.05
+)
+
+// dirStat holds the statistics of a directory that decide when it is scanned
+type dirStat struct {
+	names []string      // sorted names of the entries that are not ignored
+	heat  float64       // grows with every change in the directory, decays otherwise
+	next  int           // the cycle in which the directory is to be scanned again
+	took  time.Duration // how long the last scan of the directory took
+}
+
+// tree holds the state of the polled directory tree. Instead of walking the
+// whole tree on every scan, directories are scanned one by one: directories
+// that changed recently (hot ones) are scanned first and on every cycle, others
+// (cold ones) are only scanned every few cycles, large ones even less often.
+// That is only once scanning the whole tree takes a real share of the
+// interval, smaller trees are scanned completely on every cycle.
+type tree struct {
+	dir     string
+	snap    map[string]entry    // state of every file and directory by relative path
+	dirs    map[string]*dirStat // statistics of every directory, "." is the root
+	ignore  []string            // the ignore patterns the snapshot was taken with
+	cycle   int
+	skipped bool // whether the cold directories were left for this cycle
+}
+
+// newTree returns the state of directory tree 'dir', before it was scanned
+func newTree(dir string) *tree {
+	return &tree{dir: dir, dirs: map[string]*dirStat{}}
+}
+
+// scanned returns whether the tree was scanned successfully at least once
+func (t *tree) scanned() bool { return t.snap != nil }
+
+// due returns the directories that are to be scanned in this cycle. First the
+// hot ones in order of their heat and the ones that were marked, which are
+// known to have changed, then the cold ones. If scanning every directory takes
+// less than a small share of interval 'ival' all cold ones are due.
+func (t *tree) due(ival time.Duration) (first, cold []string) {
+	var marked, later []string
+	var cost time.Duration
+	for rel, st := range t.dirs {
+		cost += st.took
+		switch {
+		case st.heat >= hotHeat:
+			first = append(first, rel)
+		case st.next == 0:
+			marked = append(marked, rel)
+		case st.next <= t.cycle:
+			cold = append(cold, rel)
+		default:
+			later = append(later, rel)
+		}
+	}
+
+	if float64(cost) < float64(ival)*coldShare {
+		cold = append(cold, later...)
+	}
+
+	sort.Slice(first, func(i, j int) bool {
+		if t.dirs[first[i]].heat != t.dirs[first[j]].heat {
+			return t.dirs[first[i]].heat > t.dirs[first[j]].heat
+		}
+
+		return first[i] < first[j]
+	})
+
+	sort.Strings(marked)
+	sort.Strings(cold)
+	return append(first, marked...), cold
+}
+
+// scan the directories that are due and return what changed. If a hot or
+// marked directory changed the cold ones are left for the next cycle, such
+// that the change is reported as soon as possible, but never for two cycles in
+// a row such that they're still scanned while hot ones keep changing. Marked
+// directories are never left for later, when watching there might not be a
+// next cycle until something else changes. The first scan of the tree visits
+// every directory and returns no changes. Interval 'ival' is the time since the
+// previous scan.
+func (t *tree) scan(cfg Config, coldCycles int, ival time.Duration) (c Changes, err error) {
+	t.cycle++
+	if !t.scanned() {
+		t.snap = map[string]entry{}
+		t.ignore = cfg.Ignore
+		err = t.visit(".", cfg, coldCycles, &Changes{}, map[string]entry{})
+		if err != nil {
+			t.snap, t.dirs = nil, map[string]*dirStat{}
+			return Changes{}, err
+		}
+
+		// nothing is hot yet, spread the scans of the cold directories
+		rels := make([]string, 0, len(t.dirs))
+		for rel := range t.dirs {
+			rels = append(rels, rel)
+		}
+
+		sort.Strings(rels)
+		for i, rel := range rels {
+			t.dirs[rel].heat, t.dirs[rel].next = 0, t.cycle+1+i%coldCycles
+		}
+
+		return Changes{}, nil
+	}
+
+	// entries that are ignored now are forgotten, without being reported
+	if !reflect.DeepEqual(t.ignore, cfg.Ignore) {
+		t.prune(cfg.Ignore)
+		t.ignore = cfg.Ignore
+	}
+
+	removed := map[string]entry{}
+	first, cold := t.due(ival)
+	skipped := t.skipped
+	t.skipped = false
+	for i, rel := range append(first, cold...) {
+		if i == len(first) && !c.Empty() && !skipped {
+			t.skipped = true
+			break // report changes in hot directories right away
+		}
+
+		if _, ok := t.dirs[rel]; !ok {
+			continue // removed while scanning its parent
+		}
+
+		verr := t.visit(rel, cfg, coldCycles, &c, removed)
+		if verr != nil && err == nil {
+			err = verr
+		}
+	}
+
+	sort.Strings(c.Created)
+	sort.Strings(c.Deleted)
+	c.Created, c.Deleted, c.Renamed = renames(removed, t.snap, c.Created, c.Deleted)
+	sort.Strings(c.Modified)
+	return
+}
+
+// visit scans directory 'rel' and records the changes to its entries in 'c',
+// the entries that were deleted are recorded in 'removed'. Directories that
+// were created are visited right away.
+func (t *tree) visit(rel string, cfg Config, coldCycles int, c *Changes, removed map[string]entry) error {
+	start := time.Now()
+	st, ok := t.dirs[rel]
+	if !ok {
+		st = &dirStat{}
+		t.dirs[rel] = st
+	}
+
+	f, err := os.Open(filepath.Join(t.dir, rel))
+	if err != nil {
+		if os.IsNotExist(err) && rel != "." {
+			return nil // it was removed, which is recorded when its parent is visited
+		}
+
+		return err
+	}
+
+	fis, err := f.Readdir(-1)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	var changes int
+	var nested time.Duration // spent visiting the directories that were created
+	names := make([]string, 0, len(fis))
+	seen := make(map[string]bool, len(fis))
+	for _, fi := range fis {
+		crel := filepath.Join(rel, fi.Name())
+		if matchesAny(crel, cfg.Ignore) {
+			continue
+		}
+
+		names = append(names, fi.Name())
+		seen[fi.Name()] = true
+
+		e := newEntry(fi)
+		pe, ok := t.snap[crel]
+		switch {
+		case ok && pe.mode.IsDir() != e.mode.IsDir():
+			t.remove(crel, c, removed)
+			fallthrough
+		case !ok:
+			c.Created = append(c.Created, crel)
+			t.snap[crel] = e
+			changes++
+			if e.mode.IsDir() {
+				vstart := time.Now()
+				err = t.visit(crel, cfg, coldCycles, c, removed)
+				nested += time.Since(vstart)
+				if err != nil {
+					return err
+				}
+			}
+		case !e.mode.IsDir() && e.modified(pe):
+			c.Modified = append(c.Modified, crel)
+			t.snap[crel] = e
+			changes++
+		default:
+			t.snap[crel] = e
+		}
+	}
+
+	for _, name := range st.names {
+		if !seen[name] {
+			t.remove(filepath.Join(rel, name), c, removed)
+			changes++
+		}
+	}
+
+	sort.Strings(names)
+	st.names = names
+	st.heat = st.heat*heatDecay + float64(changes)
+	st.next = t.cycle + coldCycles
+	if len(names) > largeDir {
+		st.next = t.cycle + coldCycles*4
+	}
+
+	st.took = time.Since(start) - nested
+
+	return nil
+}
+
+// remove the file or directory 'rel' and everything in it from the tree, the
+// removals are recorded as deletions in 'c' and 'removed' if they're not nil
+func (t *tree) remove(rel string, c *Changes, removed map[string]entry) {
+	if st, ok := t.dirs[rel]; ok {
+		for _, name := range st.names {
+			t.remove(filepath.Join(rel, name), c, removed)
+		}
+
+		delete(t.dirs, rel)
+	}
+
+	if c != nil {
+		c.Deleted = append(c.Deleted, rel)
+		removed[rel] = t.snap[rel]
+	}
+
+	delete(t.snap, rel)
+}
+
+// prune forgets the entries that match the ignore patterns
+func (t *tree) prune(ignore []string) {
+	for rel, st := range t.dirs {
+		names := st.names[:0]
+		for _, name := range st.names {
+			if !matchesAny(filepath.Join(rel, name), ignore) {
+				names = append(names, name)
+			}
+		}
+
+		st.names = names
+	}
+
+	for rel := range t.snap {
+		if ignored(rel, ignore) {
+			t.remove(rel, nil, nil)
+		}
+	}
+}
+
+// mark directory 'rel', or the directory of file 'rel', to be scanned in the
+// next cycle. If 'rel' is the root every directory is marked.
+func (t *tree) mark(rel string) {
+	if rel == "." {
+		for _, st := range t.dirs {
+			st.next = 0
+		}
+	}
+
+	for _, p := range []string{rel, filepath.Dir(rel)} {
+		if st, ok := t.dirs[p]; ok {
+			st.next = 0
+		}
+	}
+}
+
+// matchesAny returns whether 'rel' itself matches any of the patterns
+func matchesAny(rel string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if m, _ := filepath.Match(pattern, rel); m {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,219 @@
+//go:build linux
+// +build linux
+
+package poller
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// inotifyMask selects the events that indicate a change in a watched directory
+const inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY | syscall.IN_ATTRIB |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF | syscall.IN_ONLYDIR
+
+// inotifyWatcher watches a directory tree using inotify, every directory in
+// the tree that isn't ignored has its own watch.
+type inotifyWatcher struct {
+	f      *os.File
+	fd     int
+	dir    string
+	ignore []string
+	events chan string
+	errs   chan error
+	done   chan struct{}
+	once   sync.Once
+
+	mu  sync.Mutex
+	wds map[int32]string // watched directory by watch descriptor
+}
+
+func newWatcher(dir string, ignore []string) (Watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init inotify: %w", err)
+	}
+
+	// a non-blocking file is read through the runtime poller, such that
+	// closing it unblocks the reading goroutine
+	w := &inotifyWatcher{
+		f:      os.NewFile(uintptr(fd), "inotify"),
+		fd:     fd,
+		dir:    dir,
+		ignore: ignore,
+		events: make(chan string),
+		errs:   make(chan error),
+		done:   make(chan struct{}),
+		wds:    map[int32]string{},
+	}
+
+	err = w.addTree(dir)
+	if err != nil {
+		w.f.Close()
+		return nil, err
+	}
+
+	go w.read()
+	return w, nil
+}
+
+// Events receives the paths that changed
+func (w *inotifyWatcher) Events() <-chan string { return w.events }
+
+// Errors receives errors that occur while watching
+func (w *inotifyWatcher) Errors() <-chan error { return w.errs }
+
+// Close stops watching, the channels are closed once reading has stopped
+func (w *inotifyWatcher) Close() (err error) {
+	w.once.Do(func() {
+		close(w.done)
+		err = w.f.Close()
+	})
+
+	return
+}
+
+// addTree adds a watch for directory 'dir' and every directory in it that
+// isn't ignored
+func (w *inotifyWatcher) addTree(dir string) error {
+	return filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path != dir {
+				return nil // removed while walking, it will show up as an event
+			}
+
+			return err
+		}
+
+		if !fi.IsDir() {
+			return nil
+		}
+
+		if w.ignored(path) {
+			return filepath.SkipDir
+		}
+
+		wd, err := syscall.InotifyAddWatch(w.fd, path, inotifyMask)
+		switch {
+		case errors.Is(err, syscall.ENOSPC):
+			return fmt.Errorf("failed to watch '%s': %w", path, ErrWatchLimit)
+		case errors.Is(err, syscall.ENOENT) && path != dir:
+			return nil
+		case err != nil:
+			return fmt.Errorf("failed to watch '%s': %w", path, err)
+		}
+
+		w.mu.Lock()
+		w.wds[int32(wd)] = path
+		w.mu.Unlock()
+		return nil
+	})
+}
+
+// read events from the inotify file until it is closed, new directories are
+// watched as they appear
+func (w *inotifyWatcher) read() {
+	defer close(w.events)
+	defer close(w.errs)
+
+	buf := make([]byte, (syscall.SizeofInotifyEvent+syscall.NAME_MAX+1)*64)
+	for {
+		n, err := w.f.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				w.sendErr(fmt.Errorf("failed to read inotify events: %w", err))
+			}
+
+			return
+		}
+
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			name := buf[off+syscall.SizeofInotifyEvent : off+syscall.SizeofInotifyEvent+int(ev.Len)]
+			off += syscall.SizeofInotifyEvent + int(ev.Len)
+
+			if !w.handle(ev.Wd, ev.Mask, nameString(name)) {
+				return
+			}
+		}
+	}
+}
+
+// handle a single event, it returns false if the watcher was closed
+func (w *inotifyWatcher) handle(wd int32, mask uint32, name string) bool {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		return w.send(w.dir) // events were lost, anything may have changed
+	}
+
+	w.mu.Lock()
+	dir, ok := w.wds[wd]
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(w.wds, wd) // the directory was removed
+	}
+	w.mu.Unlock()
+	if !ok || mask&syscall.IN_IGNORED != 0 {
+		return true
+	}
+
+	p := dir
+	if name != "" {
+		p = filepath.Join(dir, name)
+	}
+
+	if w.ignored(p) {
+		return true
+	}
+
+	// directories that appear are watched as well, files that were created in
+	// them before the watch was added will not cause an event of their own
+	if mask&syscall.IN_ISDIR != 0 && mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+		err := w.addTree(p)
+		if err != nil && !w.sendErr(err) {
+			return false
+		}
+	}
+
+	return w.send(p)
+}
+
+// ignored returns whether path 'p' in the watched tree is ignored
+func (w *inotifyWatcher) ignored(p string) bool {
+	rel, err := filepath.Rel(w.dir, p)
+	return err == nil && rel != "." && ignored(rel, w.ignore)
+}
+
+// send a changed path, it returns false if the watcher was closed
+func (w *inotifyWatcher) send(p string) bool {
+	select {
+	case w.events <- p:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+// sendErr sends an error, it returns false if the watcher was closed
+func (w *inotifyWatcher) sendErr(err error) bool {
+	select {
+	case w.errs <- err:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+// nameString returns the file name of an event, which is padded with zeros
+func nameString(name []byte) string {
+	for i, c := range name {
+		if c == 0 {
+			return string(name[:i])
+		}
+	}
+
+	return string(name)
+}
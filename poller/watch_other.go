@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package poller
+
+// newWatcher is not supported, the poller falls back to scanning
+func newWatcher(dir string, ignore []string) (Watcher, error) {
+	return nil, ErrWatchUnsupported
+}
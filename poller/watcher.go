@@ -0,0 +1,56 @@
+package poller
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+)
+
+// ErrWatchLimit is returned by a watcher when the system won't allow any more
+// directories to be watched, i.e: when the inotify watch limit is reached
+var ErrWatchLimit = errors.New("watch limit reached")
+
+// ErrWatchUnsupported is returned by NewWatcher on platforms that have no
+// native watcher implementation
+var ErrWatchUnsupported = errors.New("watching is not supported on this platform")
+
+// A Watcher is notified by the operating system of changes in a directory tree,
+// such that it doesn't have to be scanned repeatedly.
+type Watcher interface {
+
+	// Events receives the path of every file or directory that changed. Paths
+	// are not deduplicated, a single write may cause several events.
+	Events() <-chan string
+
+	// Errors receives errors that occur while watching, it receives an error
+	// that wraps ErrWatchLimit if new directories can no longer be watched.
+	Errors() <-chan error
+
+	// Close stops watching and closes the channels
+	Close() error
+}
+
+// NewWatcher starts watching directory 'dir' and all directories in it,
+// including directories that are created later. Files and directories that
+// match any of the ignore patterns, or are in a directory that does, are not
+// watched. It returns an error that wraps ErrWatchLimit if the tree has more
+// directories than may be watched.
+func NewWatcher(dir string, ignore ...string) (w Watcher, err error) {
+	return newWatcher(dir, ignore)
+}
+
+// ignored returns whether the slash or filepath separated path 'rel' matches
+// any of the ignore patterns, or is in a directory that does.
+func ignored(rel string, patterns []string) bool {
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i := range parts {
+		prefix := filepath.Join(parts[:i+1]...)
+		for _, pattern := range patterns {
+			if m, _ := filepath.Match(pattern, prefix); m {
+				return true
+			}
+		}
+	}
+
+	return false
+}
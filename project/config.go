@@ -0,0 +1,261 @@
+package project
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ConfigFilename is the name of the file in the project directory from
+// which the configuration is loaded.
+const ConfigFilename = "wire.json"
+
+// LoadConfig reads the configuration file at path 'p' on top of the default
+// configuration. If the file doesn't exist the default configuration is
+// returned. Keys in the file that don't map onto the configuration are
+// returned as warnings, the resulting configuration is validated.
+func LoadConfig(p string) (cfg Config, warns []string, err error) {
+	cfg = DefaultConfig()
+
+	data, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return cfg, nil, nil
+	} else if err != nil {
+		return cfg, nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var raw map[string]interface{}
+	err = json.Unmarshal(data, &raw)
+	if err != nil {
+		return cfg, nil, fmt.Errorf("failed to parse '%s': %w", filepath.Base(p), err)
+	}
+
+	warns, err = decodeConfig(raw, reflect.ValueOf(&cfg).Elem(), "")
+	if err != nil {
+		return cfg, warns, fmt.Errorf("failed to decode '%s': %w", filepath.Base(p), err)
+	}
+
+	err = cfg.Validate()
+	if err != nil {
+		return cfg, warns, fmt.Errorf("invalid config in '%s': %w", filepath.Base(p), err)
+	}
+
+	return
+}
+
+// Validate checks the configuration for values that can't work
+func (cfg Config) Validate() error {
+	if cfg.EmbedFilename == "" || filepath.Ext(cfg.EmbedFilename) != ".go" {
+		return fmt.Errorf("embed filename '%s' must be a Go file", cfg.EmbedFilename)
+	}
+
+	if filepath.IsAbs(cfg.EmbedFilename) {
+		return fmt.Errorf("embed filename '%s' must be relative to the project dir", cfg.EmbedFilename)
+	}
+
+	if filepath.IsAbs(cfg.StaticDir) {
+		return fmt.Errorf("static dir '%s' must be relative to the project dir", cfg.StaticDir)
+	}
+
+	for _, pattern := range cfg.StaticIgnore {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid static ignore pattern '%s': %w", pattern, err)
+		}
+	}
+
+	for _, pattern := range cfg.Fingerprint {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid fingerprint pattern '%s': %w", pattern, err)
+		}
+	}
+
+	if cfg.WasmFilename == "" {
+		return errors.New("wasm filename must not be empty")
+	}
+
+	if cfg.MaxWasmBuildTime <= 0 {
+		return errors.New("max wasm build time must be positive")
+	}
+
+	if cfg.MaxServeBuildTime <= 0 {
+		return errors.New("max serve build time must be positive")
+	}
+
+	if err := cfg.Hooks.Validate(); err != nil {
+		return fmt.Errorf("invalid hooks: %w", err)
+	}
+
+	for i, step := range cfg.Pipeline {
+		if err := step.Validate(); err != nil {
+			return fmt.Errorf("invalid pipeline step %d: %w", i, err)
+		}
+	}
+
+	if err := cfg.Runner.Validate(); err != nil {
+		return fmt.Errorf("invalid runner config: %w", err)
+	}
+
+	if cfg.Poller.MinInterval < 0 || cfg.Poller.MaxInterval < 0 {
+		return errors.New("poller intervals must not be negative")
+	}
+
+	if cfg.Poller.Backoff < 0 {
+		return errors.New("poller backoff must not be negative")
+	}
+
+	if cfg.Poller.ColdCycles < 0 {
+		return errors.New("poller cold cycles must not be negative")
+	}
+
+	for _, pattern := range cfg.Poller.Ignore {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid poller ignore pattern '%s': %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// durationType is used to decode durations from strings such as "5s"
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// decodeConfig sets the fields of struct value 'v' from the raw json object. Keys
+// are matched against field names case-insensitively, ignoring underscores and
+// dashes so that both "EmbedFilename" and "embed_filename" can be used. Keys
+// that don't map to any field are returned as warnings.
+func decodeConfig(raw map[string]interface{}, v reflect.Value, prefix string) (warns []string, err error) {
+	keys := make([]string, 0, len(raw))
+	for k := range raw {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	for _, k := range keys {
+		rv := raw[k]
+		f, ok := configField(v, k)
+		if !ok {
+			warns = append(warns, fmt.Sprintf("unknown config key '%s'", prefix+k))
+			continue
+		}
+
+		fwarns, err := decodeConfigValue(rv, f, prefix+k)
+		warns = append(warns, fwarns...)
+		if err != nil {
+			return warns, err
+		}
+	}
+
+	return
+}
+
+// configField finds the field in struct value 'v' that matches config key 'k'
+func configField(v reflect.Value, k string) (f reflect.Value, ok bool) {
+	norm := strings.NewReplacer("_", "", "-", "").Replace(k)
+	for i := 0; i < v.NumField(); i++ {
+		sf := v.Type().Field(i)
+		if sf.PkgPath != "" {
+			continue // unexported
+		}
+
+		if strings.EqualFold(sf.Name, norm) {
+			return v.Field(i), true
+		}
+	}
+
+	return
+}
+
+// decodeConfigValue sets 'v' from raw json value 'rv', the key is used for
+// error messages and warnings
+func decodeConfigValue(rv interface{}, v reflect.Value, key string) (warns []string, err error) {
+	if v.Type() == durationType {
+		switch rv := rv.(type) {
+		case string:
+			d, err := time.ParseDuration(rv)
+			if err != nil {
+				return nil, fmt.Errorf("invalid duration for '%s': %w", key, err)
+			}
+
+			v.SetInt(int64(d))
+			return nil, nil
+		case float64:
+			return nil, fmt.Errorf("expected duration for '%s', got: %v (use a duration string like \"2s\")", key, rv)
+		default:
+			return nil, fmt.Errorf("expected duration for '%s', got: %T", key, rv)
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		obj, ok := rv.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected object for '%s', got: %T", key, rv)
+		}
+
+		return decodeConfig(obj, v, key+".")
+	case reflect.Slice:
+		arr, ok := rv.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected array for '%s', got: %T", key, rv)
+		}
+
+		s := reflect.MakeSlice(v.Type(), len(arr), len(arr))
+		for i, erv := range arr {
+			ewarns, err := decodeConfigValue(erv, s.Index(i), fmt.Sprintf("%s[%d]", key, i))
+			warns = append(warns, ewarns...)
+			if err != nil {
+				return warns, err
+			}
+		}
+
+		v.Set(s)
+		return warns, nil
+	case reflect.String:
+		s, ok := rv.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected string for '%s', got: %T", key, rv)
+		}
+
+		v.SetString(s)
+	case reflect.Bool:
+		b, ok := rv.(bool)
+		if !ok {
+			return nil, fmt.Errorf("expected boolean for '%s', got: %T", key, rv)
+		}
+
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := rv.(float64)
+		if !ok || n != float64(int64(n)) {
+			return nil, fmt.Errorf("expected integer for '%s', got: %v", key, rv)
+		}
+
+		v.SetInt(int64(n))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := rv.(float64)
+		if !ok || n < 0 || n != float64(uint64(n)) {
+			return nil, fmt.Errorf("expected positive integer for '%s', got: %v", key, rv)
+		}
+
+		v.SetUint(uint64(n))
+	case reflect.Float32, reflect.Float64:
+		n, ok := rv.(float64)
+		if !ok {
+			return nil, fmt.Errorf("expected number for '%s', got: %T", key, rv)
+		}
+
+		v.SetFloat(n)
+	default:
+		return nil, fmt.Errorf("unsupported config value for '%s'", key)
+	}
+
+	return nil, nil
+}
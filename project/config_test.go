@@ -0,0 +1,87 @@
+package project_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wirebase/wire/project"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir, clean := setupTestProject(t)
+	defer clean()
+
+	p := filepath.Join(dir, project.ConfigFilename)
+
+	t.Run("no config file", func(t *testing.T) {
+		cfg, warns, err := project.LoadConfig(p)
+		if err != nil || len(warns) != 0 {
+			t.Fatalf("expected no error or warnings, got: %v %v", err, warns)
+		}
+
+		if !reflect.DeepEqual(cfg, project.DefaultConfig()) {
+			t.Fatalf("expected default config, got: %+v", cfg)
+		}
+	})
+
+	t.Run("valid config file", func(t *testing.T) {
+		ioutil.WriteFile(p, []byte(`{
+			"embed_filename": "assets.go",
+			"MaxWasmBuildTime": "10s",
+			"poller": {"ignore": ["node_modules"]},
+			"runner": {"args": ["-foo"], "env": ["BAR=1"], "bogus": 1},
+			"typo": true
+		}`), 0777)
+
+		cfg, warns, err := project.LoadConfig(p)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		exp := []string{"unknown config key 'runner.bogus'", "unknown config key 'typo'"}
+		if !reflect.DeepEqual(warns, exp) {
+			t.Fatalf("expected warnings: %v, got: %v", exp, warns)
+		}
+
+		if cfg.EmbedFilename != "assets.go" || cfg.MaxWasmBuildTime != time.Second*10 {
+			t.Fatalf("expected config to be decoded, got: %+v", cfg)
+		}
+
+		if cfg.WasmFilename != "main.wasm" || cfg.MaxServeBuildTime != time.Second*30 {
+			t.Fatalf("expected defaults to be kept, got: %+v", cfg)
+		}
+
+		if !reflect.DeepEqual(cfg.Poller.Ignore, []string{"node_modules"}) ||
+			!reflect.DeepEqual(cfg.Runner.Args, []string{"-foo"}) ||
+			!reflect.DeepEqual(cfg.Runner.Env, []string{"BAR=1"}) {
+			t.Fatalf("expected nested config to be decoded, got: %+v", cfg)
+		}
+	})
+
+	for name, c := range map[string]struct {
+		data string
+		msg  string
+	}{
+		"syntax error":         {`{"embed_filename": `, "failed to parse"},
+		"wrong type":           {`{"embed_filename": 5}`, "expected string for 'embed_filename'"},
+		"bad duration":         {`{"max_serve_build_time": "5 sec"}`, "invalid duration"},
+		"numeric duration":     {`{"poller": {"max_interval": 2}}`, `use a duration string like "2s"`},
+		"not a go file":        {`{"embed_filename": "bundle.txt"}`, "must be a Go file"},
+		"zero build time":      {`{"max_wasm_build_time": "0s"}`, "must be positive"},
+		"negative backoff":     {`{"poller": {"backoff": -1.5}}`, "must not be negative"},
+		"negative cold cycles": {`{"poller": {"cold_cycles": -1}}`, "must not be negative"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ioutil.WriteFile(p, []byte(c.data), 0777)
+
+			_, _, err := project.LoadConfig(p)
+			if err == nil || !strings.Contains(err.Error(), c.msg) {
+				t.Fatalf("expected error containing '%s', got: %v", c.msg, err)
+			}
+		})
+	}
+}
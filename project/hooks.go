@@ -0,0 +1,116 @@
+package project
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/wirebase/wire/runner"
+)
+
+// Hook is a command that is run in the project directory at a specific
+// point of every rebuild.
+type Hook struct {
+
+	// Command holds the program and the arguments to run
+	Command []string
+
+	// Timeout is how long the command is allowed to run, Defaults to 30s
+	Timeout time.Duration
+
+	// IgnoreFailure will cause a failing hook to only be reported instead of
+	// aborting the rebuild.
+	IgnoreFailure bool
+}
+
+// Hooks configures the commands that are run during each rebuild. Hooks get
+// the following environment variables on top of the existing ones:
+//
+//	WIRE_PROJECT_DIR - the project directory
+//	WIRE_EMBED_FILE  - path to the embed file
+//	WIRE_BUNDLE_DIR  - the directory with assets that will be embedded (bundle hooks)
+//	WIRE_WASM        - path to the wasm binary in the bundle dir (bundle hooks)
+//	WIRE_BINARY      - path to the serving binary (build and run hooks)
+type Hooks struct {
+
+	// PreBundle hooks run before any asset is added to the bundle dir
+	PreBundle []Hook
+
+	// PostBundle hooks run after all assets are added to the bundle dir but
+	// before the embed file is written, they may change the bundle dir
+	PostBundle []Hook
+
+	// PreBuild hooks run before the serving binary is built
+	PreBuild []Hook
+
+	// PreRun hooks run before the serving binary is (re)started
+	PreRun []Hook
+
+	// PostRun hooks run after the serving binary has been started
+	PostRun []Hook
+}
+
+// Validate checks the hooks for values that can't work
+func (h Hooks) Validate() error {
+	for _, stage := range []struct {
+		name  string
+		hooks []Hook
+	}{
+		{"pre_bundle", h.PreBundle},
+		{"post_bundle", h.PostBundle},
+		{"pre_build", h.PreBuild},
+		{"pre_run", h.PreRun},
+		{"post_run", h.PostRun},
+	} {
+		for i, hook := range stage.hooks {
+			if len(hook.Command) < 1 || hook.Command[0] == "" {
+				return fmt.Errorf("%s hook %d has no command", stage.name, i)
+			}
+		}
+	}
+
+	return nil
+}
+
+// runHooks runs each hook in order in directory 'dir' with the provided extra
+// environment variables. The first hook that fails aborts the rest, unless
+// it is configured to ignore failures, then it is only reported to the ui.
+func runHooks(ui UI, dir, stage string, hooks []Hook, env ...string) (err error) {
+	for _, hook := range hooks {
+		err = runHook(ui, dir, hook, env)
+		if err == nil {
+			continue
+		}
+
+		err = fmt.Errorf("%s hook '%s' failed: %w", stage, strings.Join(hook.Command, " "), err)
+		if !hook.IgnoreFailure {
+			return err
+		}
+
+		ui.ShowHookFailed(err)
+	}
+
+	return nil
+}
+
+// runHook runs a single hook, the output of the hook is shown to the user
+// when it succeeds and is part of the error when it fails
+func runHook(ui UI, dir string, hook Hook, env []string) (err error) {
+	cmd := exec.Command(hook.Command[0], hook.Command[1:]...)
+	cmd.Dir = dir
+	cmd.Env = append(append(os.Environ(), "WIRE_PROJECT_DIR="+dir), env...)
+
+	out, err := runner.RunCommand(cmd, hook.Timeout)
+	if err != nil {
+		return err
+	}
+
+	if len(out) > 0 {
+		io.WriteString(ui, out)
+	}
+
+	return nil
+}
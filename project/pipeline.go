@@ -0,0 +1,59 @@
+package project
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/wirebase/wire/bundle"
+)
+
+// Step is a single step of the asset pipeline that operates on the bundle dir
+// before it is turned into the embed file. Each step either runs a command or
+// removes files.
+type Step struct {
+
+	// Command holds the program and the arguments to run in the bundle dir,
+	// i.e: to minify assets.
+	Command []string
+
+	// Timeout is how long the command is allowed to run, Defaults to 30s
+	Timeout time.Duration
+
+	// Remove holds patterns of files that are removed from the bundle, a
+	// pattern without a slash matches the file name in any directory.
+	Remove []string
+}
+
+// Validate checks the step for values that can't work
+func (s Step) Validate() error {
+	switch {
+	case len(s.Command) > 0 && len(s.Remove) > 0:
+		return errors.New("step must either have a command or remove files, not both")
+	case len(s.Command) > 0:
+		if s.Command[0] == "" {
+			return errors.New("step has no command")
+		}
+	case len(s.Remove) > 0:
+		for _, pattern := range s.Remove {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid remove pattern '%s': %w", pattern, err)
+			}
+		}
+	default:
+		return errors.New("step has nothing to do")
+	}
+
+	return nil
+}
+
+// transformer returns the bundle transformer for the step. Commands get the
+// same environment as the bundle hooks and their output is shown on the ui.
+func (s Step) transformer(ui UI, env []string) bundle.Transformer {
+	if len(s.Remove) > 0 {
+		return bundle.Remove(s.Remove...)
+	}
+
+	return bundle.Command{Args: s.Command, Env: env, Timeout: s.Timeout, Output: ui}
+}
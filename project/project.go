@@ -1,9 +1,15 @@
 package project
 
 import (
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"strconv"
 	"time"
@@ -11,7 +17,9 @@ import (
 	"github.com/wirebase/wire/bundle"
 	"github.com/wirebase/wire/compile"
 	"github.com/wirebase/wire/poller"
+	"github.com/wirebase/wire/proxy"
 	"github.com/wirebase/wire/runner"
+	"github.com/wirebase/wire/vfsgen"
 )
 
 // Config configures the development server
@@ -21,10 +29,41 @@ type Config struct {
 	// to which the bundle filesystem will be written. Defaults to 'bundle.go'
 	EmbedFilename string
 
+	// StaticDir is the directory, relative to the project directory, of which
+	// all files are copied into the bundle. Defaults to 'static' or 'public',
+	// whichever exists.
+	StaticDir string
+
+	// StaticIgnore holds patterns of files and directories in the static dir
+	// that are not copied, a pattern without a slash matches the name at any
+	// depth. Defaults to ignoring hidden files.
+	StaticIgnore []string
+
+	// GoEmbed will write the assets to a directory next to the embed file that
+	// is included using go:embed, which builds faster than the assets encoded in
+	// the embed file. The go.mod of the project must declare go 1.16 or later.
+	GoEmbed bool
+
+	// Reproducible gives all assets the same mod time such that the embed file
+	// is identical for identical assets, which makes for clean diffs when it is
+	// committed. The time is taken from SOURCE_DATE_EPOCH, if it isn't set the
+	// mod times are left out, which means the assets are served without a
+	// Last-Modified header by http.FileServer.
+	Reproducible bool
+
 	// WasmFilename is the name under which the webassembly binary will
 	// be stored in the bundle directory.
 	WasmFilename string
 
+	// WasmIndex will add an index.html to the bundle that loads and runs the
+	// webassembly binary, unless the static dir already provides one.
+	WasmIndex bool
+
+	// Fingerprint holds patterns of files in the bundle that get a hash of their
+	// content in their name, i.e: '*.wasm' or 'css/*.css'. The paths can be
+	// resolved at runtime through the generated manifest.
+	Fingerprint []string
+
 	// MaxWasmBuildTime configures how long the wasm build is allowed
 	// to take on each change. Defaults to 5s
 	MaxWasmBuildTime time.Duration
@@ -38,102 +77,420 @@ type Config struct {
 
 	// Runner holds configuration for the runner
 	Runner runner.Config
+
+	// Proxy holds configuration for the development proxy
+	Proxy proxy.Config
+
+	// Hooks holds commands that are run at specific points of each rebuild
+	Hooks Hooks
+
+	// Pipeline holds the steps that operate on the bundle dir, in order, before
+	// it is turned into the embed file.
+	Pipeline []Step
+}
+
+// servePrefix is the prefix of the directories in the temporary directory
+// that hold the serving binaries of a project
+const servePrefix = "wire_serve_"
+
+// serveDir returns the temporary directory for the serving binaries of the
+// project in 'dir', each project has its own such that one doesn't remove the
+// binaries of another.
+func serveDir(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		abs = dir
+	}
+
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(os.TempDir(), servePrefix+hex.EncodeToString(sum[:8]))
+}
+
+// removeBinaries removes the serving binaries of a project, except for 'keep'
+func removeBinaries(sdir, keep string) (err error) {
+	bins, err := filepath.Glob(filepath.Join(sdir, "*"))
+	if err != nil {
+		return fmt.Errorf("failed to find serve binaries: %w", err)
+	}
+
+	for _, binp := range bins {
+		if binp == keep {
+			continue
+		}
+
+		err = os.Remove(binp)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove serve binary: %w", err)
+		}
+	}
+
+	return nil
 }
 
 // DefaultConfig returns a sensible default config
 func DefaultConfig() (cfg Config) {
 	return Config{
 		EmbedFilename:     "bundle.go",
+		StaticIgnore:      []string{".*"},
 		WasmFilename:      "main.wasm",
 		MaxWasmBuildTime:  time.Second * 5,
 		MaxServeBuildTime: time.Second * 30,
+		Poller:            poller.Config{Watch: true, MaxInterval: time.Second * 2, Backoff: 1.5},
+		Runner:            runner.Config{Prefix: "[serve] "},
+		Proxy:             proxy.Config{Addr: "localhost:8080"},
 	}
 }
 
 // Project describes a source code directory that is being developed
 type Project struct {
 	dir   string
+	cfgp  string
 	pollf time.Duration
+	ui    UI
+	env   []string
+	cache *vfsgen.Cache
 }
 
-// New will setup the project
-func New(dir string, pollf time.Duration) (b *Project) {
-	b = &Project{dir: dir, pollf: pollf}
+// New will setup the project in 'dir'. The configuration is loaded from 'cfgp', if
+// it is empty the config file in the project directory is used. Feedback on the
+// progress is provided to the user through 'ui'.
+func New(dir, cfgp string, pollf time.Duration, ui UI) (b *Project) {
+	if cfgp == "" {
+		cfgp = filepath.Join(dir, ConfigFilename)
+	}
+
+	b = &Project{dir: dir, cfgp: cfgp, pollf: pollf, ui: ui, cache: vfsgen.NewCache()}
 	return
 }
 
+// Dir returns the project directory
+func (p *Project) Dir() string { return p.dir }
+
 // Run will block and start polling for changes and bundle, build and run
 // the application whenever this happens. Whenever the context is cancelled
-// the polling will stop.
+// the polling will stop. If configured, a proxy is started that forwards
+// requests to the application or shows why the last rebuild failed.
 func (p *Project) Run(ctx context.Context) error {
 	runner := runner.New()
+	runner.SetOutput(p.ui)
 	defer runner.Kill()
 
 	poller := poller.New(ctx, p.dir, p.pollf)
-	ui := NewTerseTerminal(os.Stderr)
+	go p.showExits(ctx, runner)
 
-	// start initial bundle, build and run
-	err := BundleBuildAndRun(ui, p.dir, runner, poller)
+	// the proxy address is only read once, problems with the config are
+	// reported during the first rebuild
+	cfg, _, err := LoadConfig(p.cfgp)
 	if err != nil {
-		return err
+		cfg = DefaultConfig()
 	}
 
-	// then perform the same on every change
-	for poller.Next() {
-		err := BundleBuildAndRun(ui, p.dir, runner, poller)
+	var prx *proxy.Proxy
+	if cfg.Proxy.Addr != "" {
+		prx, err = p.startProxy(ctx, cfg.Proxy)
 		if err != nil {
 			return err
 		}
+
+		prx.SetOutput(runner.Output)
+	}
+
+	// start initial bundle, build and run, then perform the same on every
+	// change. Failures are reported but the last working binary is kept
+	// running until the next change fixes them.
+	var shown string
+	var ival time.Duration
+	for ok := true; ok; ok = poller.Next() {
+		c := poller.Changes()
+		if perr := poller.Err(); c.Empty() && perr != nil {
+
+			// nothing to rebuild if scanning failed, the same error is likely
+			// to occur on every scan so it is only shown when it changes
+			if perr.Error() != shown {
+				p.ui.ShowPollFailed(perr)
+				shown = perr.Error()
+			}
+
+			continue
+		}
+
+		shown = ""
+		if !c.Empty() {
+			p.ui.ShowChanges(c)
+		}
+
+		// the interval backs off while nothing changes and is stretched when
+		// scanning is slow, it is shown as it was when the change was found
+		if d := poller.Interval(); d != ival && !c.Empty() {
+			p.ui.ShowPollInterval(d)
+			ival = d
+		}
+
+		err = p.bundleBuildAndRun(runner, poller)
+		if prx != nil {
+			prx.SetErr(err)
+			prx.Reload()
+		}
+	}
+
+	return nil
+}
+
+// showExits reports every time the application exits by itself until the
+// context is cancelled
+func (p *Project) showExits(ctx context.Context, r *runner.Runner) {
+	for {
+		select {
+		case exit := <-r.Exits():
+			p.ui.ShowProcessExited(exit)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// startProxy starts the development proxy in the background, the served
+// process is told where to listen through the PORT environment variable.
+func (p *Project) startProxy(ctx context.Context, cfg proxy.Config) (prx *proxy.Proxy, err error) {
+	port, err := freePort()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find port for the application: %w", err)
+	}
+
+	p.env = append(p.env, "PORT="+port)
+	prx = proxy.New(net.JoinHostPort("127.0.0.1", port), cfg)
+
+	lis, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for proxy: %w", err)
+	}
+
+	srv := &http.Server{Handler: prx}
+	go srv.Serve(lis)
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+
+	host, lport, _ := net.SplitHostPort(lis.Addr().String())
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		host = "localhost"
+	}
+
+	p.ui.ShowProxyStarted(net.JoinHostPort(host, lport))
+	return
+}
+
+// freePort asks the kernel for a free port on the loopback interface
+func freePort() (port string, err error) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+
+	defer lis.Close()
+	_, port, err = net.SplitHostPort(lis.Addr().String())
+	return
+}
+
+// Bundle will only bundle the frontend and write the embed file to the
+// project directory.
+func (p *Project) Bundle() (err error) {
+	p.ui.ShowRebuildStarted()
+
+	cfg, err := loadConfig(p.ui, p.cfgp)
+	if err != nil {
+		return err
+	}
+
+	err = bundleFrontend(p.ui, p.dir, cfg, bundle.CompressionLevel(gzip.BestCompression))
+	if err != nil {
+		return fmt.Errorf("failed to bundle: %w", err)
+	}
+
+	p.ui.ShowBundlingDone()
+	p.ui.ShowRebuildDone()
+	return
+}
+
+// Build will bundle the frontend and build the serving binary to 'o' without
+// running it.
+func (p *Project) Build(o string) (err error) {
+	p.ui.ShowRebuildStarted()
+
+	cfg, err := loadConfig(p.ui, p.cfgp)
+	if err != nil {
+		return err
+	}
+
+	err = bundleFrontend(p.ui, p.dir, cfg, bundle.CompressionLevel(gzip.BestCompression))
+	if err != nil {
+		return fmt.Errorf("failed to bundle: %w", err)
+	}
+
+	p.ui.ShowBundlingDone()
+
+	// unlike the development loop, having nothing to build is an error here
+	servec, err := compile.New(p.dir, "", "")
+	if err != nil {
+		return fmt.Errorf("failed to build: %w", err)
+	}
+
+	err = runHooks(p.ui, p.dir, "pre_build", cfg.Hooks.PreBuild, p.hookEnv(cfg, o)...)
+	if err != nil {
+		return err
+	}
+
+	err = servec.Build(o, cfg.MaxServeBuildTime)
+	if err != nil {
+		return fmt.Errorf("failed to build: %w", err)
+	}
+
+	p.ui.ShowBuildingDone()
+	p.ui.ShowRebuildDone()
+	return
+}
+
+// Clean removes the embed file from the project directory and any serving
+// binaries of the project that were left behind in the temporary directory.
+func (p *Project) Clean() (err error) {
+	cfg, err := loadConfig(p.ui, p.cfgp)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(filepath.Join(p.dir, cfg.EmbedFilename))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove embed file: %w", err)
+	}
+
+	err = os.RemoveAll(filepath.Join(p.dir, vfsgen.DefaultEmbedDir(cfg.EmbedFilename)))
+	if err != nil {
+		return fmt.Errorf("failed to remove embedded assets: %w", err)
+	}
+
+	err = os.RemoveAll(serveDir(p.dir))
+	if err != nil {
+		return fmt.Errorf("failed to remove serve binaries: %w", err)
 	}
 
 	return nil
 }
 
 // BundleBuildAndRun will attempt to build the project in 'dir' and run it using the
-// provided runner. It will re-load the configuration from disk and update the
-// poller and runner with it.
-func BundleBuildAndRun(ui UI, dir string, runner *runner.Runner, poller *poller.Poller) (err error) {
-	ui.ShowRebuildStarted()
-
-	// setup and laod configuration
-	cfg := DefaultConfig()
-	cfg.Poller.Ignore = append(cfg.Poller.Ignore, cfg.EmbedFilename)
+// provided runner. It will re-load the configuration from 'cfgp' (if it exists) and
+// update the poller and runner with it. Failures are reported to the ui before
+// being returned, the runner is left untouched in that case.
+func BundleBuildAndRun(ui UI, dir, cfgp string, runner *runner.Runner, poller *poller.Poller) (err error) {
+	return New(dir, cfgp, 0, ui).bundleBuildAndRun(runner, poller)
+}
+
+func (p *Project) bundleBuildAndRun(runner *runner.Runner, poller *poller.Poller) (err error) {
+	p.ui.ShowRebuildStarted()
+
+	// (re)load configuration, if the file is in the project directory it is
+	// watched by the poller so any change to it will cause it to be loaded again
+	cfg, err := loadConfig(p.ui, p.cfgp)
+	if err != nil {
+		return err
+	}
+
+	cfg.Poller.Ignore = append(cfg.Poller.Ignore, cfg.EmbedFilename, vfsgen.DefaultEmbedDir(cfg.EmbedFilename))
+	cfg.Runner.Env = append(cfg.Runner.Env, p.env...)
 	poller.Update(cfg.Poller)
-	ui.ShowConfigLoaded()
 
-	// bundle frontend code
-	err = bundleFrontend(ui, dir, cfg)
+	// bundle frontend code, favouring speed since this happens on every change
+	err = bundleFrontend(p.ui, p.dir, cfg, bundle.CompressionLevel(gzip.BestSpeed), bundle.Cache(p.cache))
 	if err != nil {
-		return fmt.Errorf("failed to bundle: %w", err)
+		return p.fail(fmt.Errorf("failed to bundle: %w", err))
 	}
 
-	ui.ShowBundlingDone()
+	p.ui.ShowBundlingDone()
 
 	// build the backend
-	binp, err := buildBackend(ui, dir, cfg)
+	sdir := serveDir(p.dir)
+	err = os.MkdirAll(sdir, 0777)
 	if err != nil {
-		return fmt.Errorf("failed to build: %w", err)
+		return p.fail(fmt.Errorf("failed to create serve binary dir: %w", err))
 	}
 
-	ui.ShowBuildingDone()
+	binp := filepath.Join(sdir, strconv.FormatInt(time.Now().UnixNano(), 10))
+	err = runHooks(p.ui, p.dir, "pre_build", cfg.Hooks.PreBuild, p.hookEnv(cfg, binp)...)
+	if err != nil {
+		return p.fail(err)
+	}
+
+	ok, err := buildBackend(p.ui, p.dir, cfg, binp)
+	if err != nil {
+		return p.fail(fmt.Errorf("failed to build: %w", err))
+	}
+
+	p.ui.ShowBuildingDone()
 
 	// run the (new) binary, if build was successfull
-	if binp != "" {
+	if ok {
+		err = runHooks(p.ui, p.dir, "pre_run", cfg.Hooks.PreRun, p.hookEnv(cfg, binp)...)
+		if err != nil {
+			return p.fail(err)
+		}
+
 		err = runner.Run(binp, cfg.Runner)
 		if err != nil {
-			return fmt.Errorf("failed to run: %w", err)
+			return p.fail(fmt.Errorf("failed to run: %w", err))
 		}
 
-		ui.ShowRunningDone()
+		p.ui.ShowRunningDone()
+
+		// the binaries that were replaced are no longer running
+		err = removeBinaries(sdir, binp)
+		if err != nil {
+			return p.fail(err)
+		}
+
+		err = runHooks(p.ui, p.dir, "post_run", cfg.Hooks.PostRun, p.hookEnv(cfg, binp)...)
+		if err != nil {
+			return p.fail(err)
+		}
 	}
 
-	ui.ShowRebuildDone()
+	p.ui.ShowRebuildDone()
+	return
+}
+
+// fail reports the error that caused a rebuild to fail and returns it
+func (p *Project) fail(err error) error {
+	p.ui.ShowBuildFailed(err)
+	return err
+}
+
+// hookEnv returns the environment for build and run hooks
+func (p *Project) hookEnv(cfg Config, binp string) []string {
+	return []string{
+		"WIRE_EMBED_FILE=" + filepath.Join(p.dir, cfg.EmbedFilename),
+		"WIRE_BINARY=" + binp,
+	}
+}
+
+// loadConfig loads the configuration at 'cfgp' and reports any problems with
+// it to the user
+func loadConfig(ui UI, cfgp string) (cfg Config, err error) {
+	cfg, warns, err := LoadConfig(cfgp)
+	for _, w := range warns {
+		ui.ShowConfigWarning(w)
+	}
+
+	if err != nil {
+		ui.ShowConfigInvalid(err)
+		return cfg, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	ui.ShowConfigLoaded()
 	return
 }
 
 // Bundle will gather all the frontend code and assets and produce an filesystem
-// that can be embedded to serve them
-func bundleFrontend(ui UI, dir string, cfg Config) (err error) {
+// that can be embedded to serve them. The embed file is written with 'opts'.
+func bundleFrontend(ui UI, dir string, cfg Config, opts ...bundle.WriteOption) (err error) {
 
 	// init a new bundle
 	b, err := bundle.New()
@@ -145,7 +502,34 @@ func bundleFrontend(ui UI, dir string, cfg Config) (err error) {
 
 	ui.ShowBundleCreated()
 
+	embedp := filepath.Join(dir, cfg.EmbedFilename)
+	env := []string{
+		"WIRE_EMBED_FILE=" + embedp,
+		"WIRE_BUNDLE_DIR=" + b.Dir(),
+		"WIRE_WASM=" + filepath.Join(b.Dir(), cfg.WasmFilename),
+	}
+
+	err = runHooks(ui, dir, "pre_bundle", cfg.Hooks.PreBundle, env...)
+	if err != nil {
+		return err
+	}
+
+	// copy static assets into the bundle, the wasm binary comes after so it is
+	// not overwritten by a leftover copy in the static dir
+	staticp, err := staticDir(dir, cfg)
+	if err != nil {
+		return err
+	} else if staticp != "" {
+		err = b.Transform(bundle.Copy(staticp, cfg.StaticIgnore...))
+		if err != nil {
+			return fmt.Errorf("failed to copy static dir: %w", err)
+		}
+
+		ui.ShowStaticCopied()
+	}
+
 	// try to compile wasm to bundle
+	var wasmn, execn string
 	wasmc, err := compile.New(dir, "js", "wasm")
 	if err == nil {
 
@@ -155,12 +539,69 @@ func bundleFrontend(ui UI, dir string, cfg Config) (err error) {
 			return fmt.Errorf("failed to build wasm: %w", err)
 		}
 
+		// the binary needs the js support file of the same toolchain to run
+		execp, err := wasmc.WasmExec()
+		if err != nil {
+			return fmt.Errorf("failed to find wasm support file: %w", err)
+		}
+
+		execn = path.Join(path.Dir(filepath.ToSlash(cfg.WasmFilename)), "wasm_exec.js")
+		err = b.Transform(bundle.AddFile(execn, execp))
+		if err != nil {
+			return fmt.Errorf("failed to add wasm support file: %w", err)
+		}
+
+		wasmn = filepath.ToSlash(cfg.WasmFilename)
 		ui.ShowWasmBundled()
 	}
 
+	// run the asset pipeline over everything that ended up in the bundle
+	stepEnv := append([]string{"WIRE_PROJECT_DIR=" + dir}, env...)
+	steps := make(bundle.Pipeline, 0, len(cfg.Pipeline))
+	for _, step := range cfg.Pipeline {
+		steps = append(steps, step.transformer(ui, stepEnv))
+	}
+
+	err = b.Transform(steps...)
+	if err != nil {
+		return err
+	}
+
+	err = runHooks(ui, dir, "post_bundle", cfg.Hooks.PostBundle, env...)
+	if err != nil {
+		return err
+	}
+
+	if len(cfg.Fingerprint) > 0 {
+		err = b.Fingerprint(cfg.Fingerprint...)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the index is added last such that it loads the fingerprinted files
+	if wasmn != "" && cfg.WasmIndex {
+		err = b.Transform(bundle.Index(b.Path(wasmn), b.Path(execn)))
+		if err != nil {
+			return err
+		}
+	}
+
 	// turn bundle into an embeddable go file, write to project dir
-	embedp := filepath.Join(dir, cfg.EmbedFilename)
-	err = b.Write(embedp)
+	if cfg.GoEmbed {
+		opts = append(opts, bundle.GoEmbed())
+	}
+
+	if cfg.Reproducible {
+		epoch, err := vfsgen.SourceDateEpoch()
+		if err != nil {
+			return err
+		}
+
+		opts = append(opts, bundle.ModTime(epoch))
+	}
+
+	err = b.Write(embedp, opts...)
 	if err != nil {
 		return fmt.Errorf("failed to write embed file: %w", err)
 	}
@@ -170,20 +611,46 @@ func bundleFrontend(ui UI, dir string, cfg Config) (err error) {
 	return
 }
 
-func buildBackend(ui UI, dir string, cfg Config) (binp string, err error) {
+// staticDir returns the path of the static dir that is copied into the bundle
+// or an empty string if there is none. A configured dir must exist.
+func staticDir(dir string, cfg Config) (p string, err error) {
+	if cfg.StaticDir != "" {
+		p = filepath.Join(dir, cfg.StaticDir)
+		fi, err := os.Stat(p)
+		if err != nil {
+			return "", fmt.Errorf("failed to open static dir: %w", err)
+		} else if !fi.IsDir() {
+			return "", fmt.Errorf("static dir '%s' is not a directory", cfg.StaticDir)
+		}
+
+		return p, nil
+	}
+
+	for _, name := range []string{"static", "public"} {
+		p = filepath.Join(dir, name)
+		if fi, err := os.Stat(p); err == nil && fi.IsDir() {
+			return p, nil
+		}
+	}
+
+	return "", nil
+}
+
+// buildBackend will build the serving binary to 'binp', if there is no program
+// to build it returns false without an error
+func buildBackend(ui UI, dir string, cfg Config, binp string) (ok bool, err error) {
 
 	// start serve compile
 	servec, err := compile.New(dir, "", "")
 	if err != nil {
-		return "", nil //nothing to do
+		return false, nil //nothing to do
 	}
 
 	// compile to binary
-	binp = filepath.Join(os.TempDir(), "serve_"+strconv.FormatInt(time.Now().UnixNano(), 10))
 	err = servec.Build(binp, cfg.MaxServeBuildTime)
 	if err != nil {
-		return "", fmt.Errorf("failed to build program: %w", err)
+		return false, fmt.Errorf("failed to build program: %w", err)
 	}
 
-	return
+	return true, nil
 }
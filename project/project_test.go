@@ -3,18 +3,24 @@ package project_test
 import (
 	"bytes"
 	"context"
+	"errors"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/wirebase/wire/compile"
 	"github.com/wirebase/wire/poller"
 	"github.com/wirebase/wire/project"
 	"github.com/wirebase/wire/runner"
 )
 
 var _ project.UI = &project.TerseTerminal{}
+var _ project.UI = &project.VerboseTerminal{}
 
 func setupTestProject(tb testing.TB) (dir string, f func()) {
 	dir, err := ioutil.TempDir("", "project_test_")
@@ -59,7 +65,7 @@ func TestBuildAndRun(t *testing.T) {
 	runner := runner.New()
 	poller := poller.New(ctx, dir, time.Millisecond*10)
 	ui := project.NewTerseTerminal(buf)
-	err := project.BundleBuildAndRun(ui, dir, runner, poller)
+	err := project.BundleBuildAndRun(ui, dir, filepath.Join(dir, project.ConfigFilename), runner, poller)
 	if err != nil {
 		t.Fatalf("should build successfully, got: %v", err)
 	}
@@ -68,3 +74,493 @@ func TestBuildAndRun(t *testing.T) {
 		t.Fatalf("expected this output, got: %v", buf.String())
 	}
 }
+
+func TestBuildFailure(t *testing.T) {
+	dir, clean := setupTestProject(t)
+	defer clean()
+	writeWorkingProjectFiles(t, dir)
+	ioutil.WriteFile(filepath.Join(dir, "serve.go"), []byte(
+		`// +build !wasm
+
+    package main
+
+    func main(){ `), 0777)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+
+	buf := bytes.NewBuffer(nil)
+	runner := runner.New()
+	poller := poller.New(ctx, dir, time.Millisecond*10)
+	ui := project.NewTerseTerminal(buf)
+	err := project.BundleBuildAndRun(ui, dir, filepath.Join(dir, project.ConfigFilename), runner, poller)
+
+	var berr compile.BuildErr
+	if !errors.As(err, &berr) {
+		t.Fatalf("expected build error, got: %v", err)
+	}
+
+	if !strings.HasPrefix(buf.String(), "rebuilding.....failed\n") {
+		t.Fatalf("expected failure to be reported, got: %v", buf.String())
+	}
+}
+
+func TestStaticDir(t *testing.T) {
+	dir, clean := setupTestProject(t)
+	defer clean()
+	writeWorkingProjectFiles(t, dir)
+	os.MkdirAll(filepath.Join(dir, "public", "css"), 0777)
+	ioutil.WriteFile(filepath.Join(dir, "public", "index.html"), []byte("<html></html>"), 0777)
+	ioutil.WriteFile(filepath.Join(dir, "public", "css", "main.css"), []byte("body{}"), 0777)
+	ioutil.WriteFile(filepath.Join(dir, "public", ".gitkeep"), nil, 0777)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+
+	buf := bytes.NewBuffer(nil)
+	runner := runner.New()
+	defer runner.Kill()
+
+	poller := poller.New(ctx, dir, time.Millisecond*10)
+	err := project.BundleBuildAndRun(project.NewTerseTerminal(buf), dir, filepath.Join(dir, project.ConfigFilename), runner, poller)
+	if err != nil {
+		t.Fatalf("should build successfully, got: %v", err)
+	}
+
+	data, _ := ioutil.ReadFile(filepath.Join(dir, "bundle.go"))
+	for _, name := range []string{`"/index.html"`, `"/css/main.css"`, `"/main.wasm"`} {
+		if !strings.Contains(string(data), name) {
+			t.Fatalf("expected %s to be embedded", name)
+		}
+	}
+
+	if strings.Contains(string(data), `"/.gitkeep"`) {
+		t.Fatalf("expected hidden files to be ignored")
+	}
+}
+
+func TestWasmIndex(t *testing.T) {
+	dir, clean := setupTestProject(t)
+	defer clean()
+	writeWorkingProjectFiles(t, dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+
+	cfgp := filepath.Join(dir, project.ConfigFilename)
+	ioutil.WriteFile(cfgp, []byte(`{"wasm_filename": "app/main.wasm", "wasm_index": true, "fingerprint": ["*.wasm"]}`), 0777)
+
+	buf := bytes.NewBuffer(nil)
+	runner := runner.New()
+	defer runner.Kill()
+
+	poller := poller.New(ctx, dir, time.Millisecond*10)
+	err := project.BundleBuildAndRun(project.NewTerseTerminal(buf), dir, cfgp, runner, poller)
+	if err != nil {
+		t.Fatalf("should build successfully, got: %v", err)
+	}
+
+	data, _ := ioutil.ReadFile(filepath.Join(dir, "bundle.go"))
+	for _, name := range []string{`"/app/wasm_exec.js"`, `"/index.html"`, `m["/app/main.wasm"] = "/app/main.`} {
+		if !strings.Contains(string(data), name) {
+			t.Fatalf("expected %s to be embedded", name)
+		}
+	}
+
+	if strings.Contains(string(data), `"/app/main.wasm": `) {
+		t.Fatalf("expected wasm binary to be fingerprinted")
+	}
+}
+
+func TestGoEmbed(t *testing.T) {
+	dir, clean := setupTestProject(t)
+	defer clean()
+	writeWorkingProjectFiles(t, dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+
+	cfgp := filepath.Join(dir, project.ConfigFilename)
+	ioutil.WriteFile(cfgp, []byte(`{"go_embed": true}`), 0777)
+
+	buf := bytes.NewBuffer(nil)
+	runner := runner.New()
+	defer runner.Kill()
+
+	poller := poller.New(ctx, dir, time.Millisecond*10)
+	err := project.BundleBuildAndRun(project.NewTerseTerminal(buf), dir, cfgp, runner, poller)
+	if err != nil {
+		t.Fatalf("should build successfully, got: %v", err)
+	}
+
+	data, _ := ioutil.ReadFile(filepath.Join(dir, "bundle.go"))
+	if !strings.Contains(string(data), "//go:embed bundle_files") {
+		t.Fatalf("expected embed file to use go:embed")
+	}
+
+	fis, _ := ioutil.ReadDir(filepath.Join(dir, "bundle_files"))
+	if len(fis) < 1 {
+		t.Fatalf("expected assets to be written next to the embed file")
+	}
+}
+
+func TestReproducible(t *testing.T) {
+	dir, clean := setupTestProject(t)
+	defer clean()
+	writeWorkingProjectFiles(t, dir)
+	os.MkdirAll(filepath.Join(dir, "static"), 0777)
+	ioutil.WriteFile(filepath.Join(dir, "static", "index.html"), []byte("<html></html>"), 0777)
+	ioutil.WriteFile(filepath.Join(dir, project.ConfigFilename), []byte(`{"reproducible": true}`), 0777)
+
+	// the mod times are only left out if the environment doesn't provide one
+	if epoch, ok := os.LookupEnv("SOURCE_DATE_EPOCH"); ok {
+		os.Unsetenv("SOURCE_DATE_EPOCH")
+		defer os.Setenv("SOURCE_DATE_EPOCH", epoch)
+	}
+
+	bundle := func() []byte {
+		buf := bytes.NewBuffer(nil)
+		err := project.New(dir, "", time.Millisecond*10, project.NewTerseTerminal(buf)).Bundle()
+		if err != nil {
+			t.Fatalf("should bundle successfully, got: %v (%s)", err, buf.String())
+		}
+
+		data, _ := ioutil.ReadFile(filepath.Join(dir, "bundle.go"))
+		return data
+	}
+
+	first := bundle()
+	time.Sleep(time.Millisecond * 10)
+	if second := bundle(); !bytes.Equal(first, second) {
+		t.Fatalf("expected identical embed files for identical assets")
+	}
+
+	if strings.Contains(string(first), "time.Date(") {
+		t.Fatalf("expected mod times to be left out")
+	}
+	// by default the actual mod times are kept, such that they can be served
+	ioutil.WriteFile(filepath.Join(dir, project.ConfigFilename), []byte(`{}`), 0777)
+	if !strings.Contains(string(bundle()), "time.Date(") {
+		t.Fatalf("expected mod times to be kept by default")
+	}
+}
+
+func TestHooks(t *testing.T) {
+	dir, clean := setupTestProject(t)
+	defer clean()
+	writeWorkingProjectFiles(t, dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runner := runner.New()
+	defer runner.Kill()
+
+	poller := poller.New(ctx, dir, time.Millisecond*10)
+	go func() {
+		for poller.Next() {
+		}
+	}()
+	cfgp := filepath.Join(dir, project.ConfigFilename)
+
+	t.Run("adds to bundle", func(t *testing.T) {
+		ioutil.WriteFile(cfgp, []byte(`{"hooks": {
+			"post_bundle": [{"command": ["sh", "-c", "echo fixture > $WIRE_BUNDLE_DIR/fixture.txt"]}],
+			"pre_run": [{"command": ["sh", "-c", "test -x $WIRE_BINARY"]}]
+		}}`), 0777)
+
+		buf := bytes.NewBuffer(nil)
+		err := project.BundleBuildAndRun(project.NewTerseTerminal(buf), dir, cfgp, runner, poller)
+		if err != nil {
+			t.Fatalf("should build successfully, got: %v (%s)", err, buf.String())
+		}
+
+		data, _ := ioutil.ReadFile(filepath.Join(dir, "bundle.go"))
+		if !strings.Contains(string(data), `"/fixture.txt"`) {
+			t.Fatalf("expected hook to have added a file to the bundle")
+		}
+	})
+
+	t.Run("failure aborts", func(t *testing.T) {
+		ioutil.WriteFile(cfgp, []byte(`{"hooks": {
+			"pre_build": [{"command": ["sh", "-c", "echo broken; exit 3"]}]
+		}}`), 0777)
+
+		buf := bytes.NewBuffer(nil)
+		err := project.BundleBuildAndRun(project.NewTerseTerminal(buf), dir, cfgp, runner, poller)
+		if err == nil || !strings.Contains(err.Error(), "pre_build hook 'sh -c echo broken; exit 3' failed: exit status 3:\nbroken") {
+			t.Fatalf("expected hook failure, got: %v", err)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		ioutil.WriteFile(cfgp, []byte(`{"hooks": {
+			"pre_build": [{"command": ["sh", "-c", "sleep 3; true"], "timeout": "100ms"}]
+		}}`), 0777)
+
+		start := time.Now()
+		err := project.BundleBuildAndRun(project.NewTerseTerminal(ioutil.Discard), dir, cfgp, runner, poller)
+		if err == nil || !strings.Contains(err.Error(), "timed out after 100ms") {
+			t.Fatalf("expected hook to time out, got: %v", err)
+		}
+
+		if time.Since(start) > time.Second*2 {
+			t.Fatalf("expected hook to be killed after the timeout, took: %s", time.Since(start))
+		}
+	})
+
+	t.Run("failure ignored", func(t *testing.T) {
+		ioutil.WriteFile(cfgp, []byte(`{"hooks": {
+			"pre_build": [{"command": ["sh", "-c", "exit 3"], "ignore_failure": true}]
+		}}`), 0777)
+
+		buf := bytes.NewBuffer(nil)
+		err := project.BundleBuildAndRun(project.NewTerseTerminal(buf), dir, cfgp, runner, poller)
+		if err != nil {
+			t.Fatalf("should build successfully, got: %v", err)
+		}
+
+		if !strings.Contains(buf.String(), "warning: pre_build hook 'sh -c exit 3' failed") {
+			t.Fatalf("expected failure to be reported, got: %s", buf.String())
+		}
+	})
+}
+
+func TestServeBinaries(t *testing.T) {
+	dir, clean := setupTestProject(t)
+	defer clean()
+	writeWorkingProjectFiles(t, dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runner := runner.New()
+	defer runner.Kill()
+
+	poller := poller.New(ctx, dir, time.Millisecond*10)
+	go func() {
+		for poller.Next() {
+		}
+	}()
+
+	cfgp := filepath.Join(dir, project.ConfigFilename)
+	ioutil.WriteFile(cfgp, []byte(`{
+		"poller": {"ignore": ["*.txt"]},
+		"hooks": {"post_run": [{"command": ["sh", "-c", "dirname $WIRE_BINARY > sdir.txt; ls $(dirname $WIRE_BINARY) > bins.txt"]}]}
+	}`), 0777)
+
+	// binaries that were replaced are removed after the new one started
+	for i := 0; i < 2; i++ {
+		buf := bytes.NewBuffer(nil)
+		err := project.BundleBuildAndRun(project.NewTerseTerminal(buf), dir, cfgp, runner, poller)
+		if err != nil {
+			t.Fatalf("should build successfully, got: %v (%s)", err, buf.String())
+		}
+	}
+
+	bins, _ := ioutil.ReadFile(filepath.Join(dir, "bins.txt"))
+	if n := len(strings.Fields(string(bins))); n != 1 {
+		t.Fatalf("expected only the running binary to be left, got: %q", bins)
+	}
+
+	sdir, _ := ioutil.ReadFile(filepath.Join(dir, "sdir.txt"))
+	if !strings.HasPrefix(strings.TrimSpace(string(sdir)), os.TempDir()) {
+		t.Fatalf("expected binaries in the temp dir, got: %s", sdir)
+	}
+
+	// cleaning removes the binaries of the project only
+	other, err := ioutil.TempDir("", "wire_serve_")
+	if err != nil {
+		t.Fatalf("failed to create tempdir: %v", err)
+	}
+
+	defer os.RemoveAll(other)
+	runner.Kill()
+	err = project.New(dir, cfgp, 0, project.NewTerseTerminal(ioutil.Discard)).Clean()
+	if err != nil {
+		t.Fatalf("failed to clean: %v", err)
+	}
+
+	if _, err = os.Stat(strings.TrimSpace(string(sdir))); !os.IsNotExist(err) {
+		t.Fatalf("expected binaries to be removed, got: %v", err)
+	}
+
+	if _, err = os.Stat(other); err != nil {
+		t.Fatalf("expected binaries of other projects to be kept, got: %v", err)
+	}
+}
+
+func TestKeepRunningOnFailure(t *testing.T) {
+	dir, clean := setupTestProject(t)
+	defer clean()
+	writeWorkingProjectFiles(t, dir)
+	ioutil.WriteFile(filepath.Join(dir, "serve.go"), []byte(
+		`// +build !wasm
+
+    package main
+
+    import ("fmt"; "os"; "os/signal"; "syscall")
+
+    func main(){
+      c := make(chan os.Signal, 1)
+      signal.Notify(c, syscall.SIGTERM)
+      fmt.Println("started")
+      <-c
+      fmt.Println("stopped")
+    }`), 0777)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runner := runner.New()
+	runner.SetOutput(nil)
+	defer runner.Kill()
+
+	poller := poller.New(ctx, dir, time.Millisecond*10)
+	go func() {
+		for poller.Next() {
+		}
+	}()
+
+	cfgp := filepath.Join(dir, project.ConfigFilename)
+	ui := project.NewTerseTerminal(ioutil.Discard)
+	err := project.BundleBuildAndRun(ui, dir, cfgp, runner, poller)
+	if err != nil {
+		t.Fatalf("should build successfully, got: %v", err)
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "serve.go"), []byte("package main\n\nfunc main(){ "), 0777)
+	err = project.BundleBuildAndRun(ui, dir, cfgp, runner, poller)
+	if err == nil {
+		t.Fatalf("expected build to fail")
+	}
+
+	// the binary of the last successful build should still be running
+	output := func() (text []string) {
+		for _, l := range runner.Output() {
+			text = append(text, l.Text)
+		}
+
+		return
+	}
+
+	for start := time.Now(); len(output()) < 1; time.Sleep(time.Millisecond * 10) {
+		if time.Since(start) > time.Second*5 {
+			t.Fatalf("expected the application to start")
+		}
+	}
+
+	if out := output(); !reflect.DeepEqual(out, []string{"started"}) {
+		t.Fatalf("expected application to be running, got: %v", out)
+	}
+
+	runner.Kill()
+	if out := output(); !reflect.DeepEqual(out, []string{"started", "stopped"}) {
+		t.Fatalf("expected application to be stopped, got: %v", out)
+	}
+}
+
+// lockedBuffer is a buffer that can be written while it is being read
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestRunPollFailure(t *testing.T) {
+	dir, clean := setupTestProject(t)
+	defer clean()
+	writeWorkingProjectFiles(t, dir)
+	ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module app\n\ngo 1.13\n"), 0777)
+
+	cfgf, err := ioutil.TempFile("", "wire_config_")
+	if err != nil {
+		t.Fatalf("failed to create config file: %v", err)
+	}
+
+	defer os.Remove(cfgf.Name())
+	cfgf.WriteString(`{"proxy": {"addr": ""}, "poller": {"watch": false, "max_interval": "10ms"}}`)
+	cfgf.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	buf := &lockedBuffer{}
+	done := make(chan error)
+	go func() {
+		done <- project.New(dir, cfgf.Name(), time.Millisecond*10, project.NewTerseTerminal(buf)).Run(ctx)
+	}()
+	for start := time.Now(); !strings.Contains(buf.String(), "done\n"); time.Sleep(time.Millisecond * 10) {
+		if time.Since(start) > time.Second*10 {
+			t.Fatalf("expected initial build to be done, got: %s", buf.String())
+		}
+	}
+
+	// scanning a removed project fails on every scan, it doesn't cause rebuilds.
+	// It is moved away first such that no scan sees it partially removed.
+	if err = os.Rename(dir, dir+"_removed"); err != nil {
+		t.Fatalf("failed to move project: %v", err)
+	}
+
+	os.RemoveAll(dir + "_removed")
+	time.Sleep(time.Millisecond * 300)
+	cancel()
+	if err = <-done; err != nil {
+		t.Fatalf("expected run to stop without error, got: %v", err)
+	}
+
+	out := buf.String()
+	if n := strings.Count(out, "warning: failed to scan for changes"); n != 1 {
+		t.Fatalf("expected scan failure to be shown once, got: %s", out)
+	}
+
+	if n := strings.Count(out, "rebuilding"); n != 1 {
+		t.Fatalf("expected no rebuild after the scan failure, got: %s", out)
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	dir, clean := setupTestProject(t)
+	defer clean()
+	writeWorkingProjectFiles(t, dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runner := runner.New()
+	defer runner.Kill()
+
+	poller := poller.New(ctx, dir, time.Millisecond*10)
+	go func() {
+		for poller.Next() {
+		}
+	}()
+
+	cfgp := filepath.Join(dir, project.ConfigFilename)
+	ioutil.WriteFile(cfgp, []byte(`{"pipeline": [
+		{"command": ["sh", "-c", "echo a > a.txt; echo b > b.txt; test \"$WIRE_PROJECT_DIR\" != \"\""]},
+		{"remove": ["b.txt"]}
+	]}`), 0777)
+
+	buf := bytes.NewBuffer(nil)
+	err := project.BundleBuildAndRun(project.NewTerseTerminal(buf), dir, cfgp, runner, poller)
+	if err != nil {
+		t.Fatalf("should build successfully, got: %v (%s)", err, buf.String())
+	}
+
+	data, _ := ioutil.ReadFile(filepath.Join(dir, "bundle.go"))
+	if !strings.Contains(string(data), `"/a.txt"`) || strings.Contains(string(data), `"/b.txt"`) {
+		t.Fatalf("expected pipeline to have changed the bundle")
+	}
+}
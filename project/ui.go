@@ -3,54 +3,228 @@ package project
 import (
 	"fmt"
 	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wirebase/wire/poller"
+	"github.com/wirebase/wire/runner"
 )
 
-// UI provides feedback to the user
+// UI provides feedback to the user. The output of the application is written
+// to it line by line.
 type UI interface {
+	io.Writer
+	ShowChanges(c poller.Changes)
+	ShowPollFailed(err error)
+	ShowPollInterval(d time.Duration)
 	ShowRebuildStarted()
 	ShowRebuildDone()
 	ShowConfigLoaded()
+	ShowConfigWarning(msg string)
+	ShowConfigInvalid(err error)
 	ShowBundlingDone()
 	ShowRunningDone()
 	ShowBundleCreated()
+	ShowStaticCopied()
 	ShowWasmBundled()
 	ShowEmbedFileWritten()
 	ShowBuildingDone()
+	ShowBuildFailed(err error)
+	ShowProxyStarted(addr string)
+	ShowProcessExited(exit runner.Exit)
+	ShowHookFailed(err error)
 }
 
 // TerseTerminal is a ui implementation that writes a terse output of the
 // building process to the terminal
-type TerseTerminal struct{ w io.Writer }
+type TerseTerminal struct {
+	w       io.Writer
+	mu      sync.Mutex
+	midline bool // the last write didn't end with a newline
+}
 
 // NewTerseTerminal returns a terse terminal ui
 func NewTerseTerminal(w io.Writer) (ui *TerseTerminal) {
-	ui = &TerseTerminal{w}
+	ui = &TerseTerminal{w: w}
+	return
+}
+
+func (ui *TerseTerminal) printf(format string, args ...interface{}) {
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+	s := fmt.Sprintf(format, args...)
+	ui.midline = !strings.HasSuffix(s, "\n")
+	io.WriteString(ui.w, s)
+}
+
+// Write shows output of the application, if it is written while the progress
+// is being shown it starts on a new line
+func (ui *TerseTerminal) Write(p []byte) (n int, err error) {
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+	if ui.midline {
+		io.WriteString(ui.w, "\n")
+		ui.midline = false
+	}
+
+	return ui.w.Write(p)
+}
+
+// ShowChanges is called with the changes that triggered a rebuild
+func (ui *TerseTerminal) ShowChanges(c poller.Changes) { ui.printf("%s\n", c) }
+
+// ShowPollFailed is called when scanning for changes failed
+func (ui *TerseTerminal) ShowPollFailed(err error) {
+	ui.printf("warning: failed to scan for changes: %v\n", err)
+}
+
+// ShowPollInterval is called when the time between scans for changes changed
+func (ui *TerseTerminal) ShowPollInterval(d time.Duration) {}
+
+// ShowRebuildStarted is called when the build starts
+func (ui *TerseTerminal) ShowRebuildStarted() { ui.printf("rebuilding") }
+
+// ShowRebuildDone is called when the build is done
+func (ui *TerseTerminal) ShowRebuildDone() { ui.printf("done\n") }
+
+// ShowConfigLoaded is called when the config is (re)loaded
+func (ui *TerseTerminal) ShowConfigLoaded() { ui.printf(".") }
+
+// ShowConfigWarning is called for every problem with the config that
+// doesn't prevent it from being used
+func (ui *TerseTerminal) ShowConfigWarning(msg string) { ui.printf("\nwarning: %s\n", msg) }
+
+// ShowConfigInvalid is called when the config couldn't be loaded
+func (ui *TerseTerminal) ShowConfigInvalid(err error) { ui.printf("\n%v\n", err) }
+
+// ShowBundlingDone is called when the bundling is done
+func (ui *TerseTerminal) ShowBundlingDone() { ui.printf(".") }
+
+// ShowRunningDone is called when process run is done
+func (ui *TerseTerminal) ShowRunningDone() { ui.printf(".") }
+
+// ShowBundleCreated is called when the bundle is created
+func (ui *TerseTerminal) ShowBundleCreated() { ui.printf(".") }
+
+// ShowStaticCopied is called when the static dir was copied into the bundle
+func (ui *TerseTerminal) ShowStaticCopied() { ui.printf(".") }
+
+// ShowWasmBundled is called wehn the wasm has been bundled
+func (ui *TerseTerminal) ShowWasmBundled() { ui.printf(".") }
+
+// ShowEmbedFileWritten is called when the embed file was written to disk
+func (ui *TerseTerminal) ShowEmbedFileWritten() { ui.printf(".") }
+
+// ShowBuildingDone is called when the binary was built
+func (ui *TerseTerminal) ShowBuildingDone() { ui.printf(".") }
+
+// ShowBuildFailed is called when bundling, building or running failed
+func (ui *TerseTerminal) ShowBuildFailed(err error) { ui.printf("failed\n%v\n", err) }
+
+// ShowProxyStarted is called when the development proxy listens on 'addr'
+func (ui *TerseTerminal) ShowProxyStarted(addr string) {
+	ui.printf("serving on http://%s\n", addr)
+}
+
+// ShowProcessExited is called when the application exited by itself
+func (ui *TerseTerminal) ShowProcessExited(exit runner.Exit) {
+	ui.printf("application %s\n", exit)
+}
+
+// ShowHookFailed is called when a hook failed that is allowed to fail
+func (ui *TerseTerminal) ShowHookFailed(err error) { ui.printf("\nwarning: %v\n", err) }
+
+// VerboseTerminal is a ui implementation that writes every step of the
+// building process to the terminal on its own line
+type VerboseTerminal struct {
+	w     io.Writer
+	mu    sync.Mutex
+	start time.Time
+}
+
+// NewVerboseTerminal returns a verbose terminal ui
+func NewVerboseTerminal(w io.Writer) (ui *VerboseTerminal) {
+	ui = &VerboseTerminal{w: w, start: time.Now()}
 	return
 }
 
+func (ui *VerboseTerminal) show(format string, args ...interface{}) {
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+	fmt.Fprintf(ui.w, "[%6.2fs] "+format+"\n", append([]interface{}{time.Since(ui.start).Seconds()}, args...)...)
+}
+
+// Write shows output of the application
+func (ui *VerboseTerminal) Write(p []byte) (n int, err error) {
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+	return ui.w.Write(p)
+}
+
+// ShowChanges is called with the changes that triggered a rebuild
+func (ui *VerboseTerminal) ShowChanges(c poller.Changes) { ui.show("%s", c) }
+
+// ShowPollFailed is called when scanning for changes failed
+func (ui *VerboseTerminal) ShowPollFailed(err error) {
+	ui.show("warning: failed to scan for changes: %v", err)
+}
+
+// ShowPollInterval is called when the time between scans for changes changed
+func (ui *VerboseTerminal) ShowPollInterval(d time.Duration) {
+	ui.show("scanning for changes every %s", d)
+}
+
 // ShowRebuildStarted is called when the build starts
-func (ui *TerseTerminal) ShowRebuildStarted() { fmt.Fprintf(ui.w, "rebuilding") }
+func (ui *VerboseTerminal) ShowRebuildStarted() {
+	ui.mu.Lock()
+	ui.start = time.Now()
+	ui.mu.Unlock()
+	ui.show("rebuild started")
+}
 
 // ShowRebuildDone is called when the build is done
-func (ui *TerseTerminal) ShowRebuildDone() { fmt.Fprintf(ui.w, "done\n") }
+func (ui *VerboseTerminal) ShowRebuildDone() { ui.show("rebuild done") }
 
 // ShowConfigLoaded is called when the config is (re)loaded
-func (ui *TerseTerminal) ShowConfigLoaded() { fmt.Fprintf(ui.w, ".") }
+func (ui *VerboseTerminal) ShowConfigLoaded() { ui.show("config loaded") }
+
+// ShowConfigWarning is called for every problem with the config that
+// doesn't prevent it from being used
+func (ui *VerboseTerminal) ShowConfigWarning(msg string) { ui.show("warning: %s", msg) }
+
+// ShowConfigInvalid is called when the config couldn't be loaded
+func (ui *VerboseTerminal) ShowConfigInvalid(err error) { ui.show("%v", err) }
 
 // ShowBundlingDone is called when the bundling is done
-func (ui *TerseTerminal) ShowBundlingDone() { fmt.Fprintf(ui.w, ".") }
+func (ui *VerboseTerminal) ShowBundlingDone() { ui.show("bundling done") }
 
 // ShowRunningDone is called when process run is done
-func (ui *TerseTerminal) ShowRunningDone() { fmt.Fprintf(ui.w, ".") }
+func (ui *VerboseTerminal) ShowRunningDone() { ui.show("process started") }
 
 // ShowBundleCreated is called when the bundle is created
-func (ui *TerseTerminal) ShowBundleCreated() { fmt.Fprintf(ui.w, ".") }
+func (ui *VerboseTerminal) ShowBundleCreated() { ui.show("bundle created") }
+
+// ShowStaticCopied is called when the static dir was copied into the bundle
+func (ui *VerboseTerminal) ShowStaticCopied() { ui.show("static assets copied") }
 
 // ShowWasmBundled is called wehn the wasm has been bundled
-func (ui *TerseTerminal) ShowWasmBundled() { fmt.Fprintf(ui.w, ".") }
+func (ui *VerboseTerminal) ShowWasmBundled() { ui.show("wasm bundled") }
 
 // ShowEmbedFileWritten is called when the embed file was written to disk
-func (ui *TerseTerminal) ShowEmbedFileWritten() { fmt.Fprintf(ui.w, ".") }
+func (ui *VerboseTerminal) ShowEmbedFileWritten() { ui.show("embed file written") }
 
 // ShowBuildingDone is called when the binary was built
-func (ui *TerseTerminal) ShowBuildingDone() { fmt.Fprintf(ui.w, ".") }
+func (ui *VerboseTerminal) ShowBuildingDone() { ui.show("building done") }
+
+// ShowBuildFailed is called when bundling, building or running failed
+func (ui *VerboseTerminal) ShowBuildFailed(err error) { ui.show("build failed: %v", err) }
+
+// ShowProxyStarted is called when the development proxy listens on 'addr'
+func (ui *VerboseTerminal) ShowProxyStarted(addr string) { ui.show("serving on http://%s", addr) }
+
+// ShowProcessExited is called when the application exited by itself
+func (ui *VerboseTerminal) ShowProcessExited(exit runner.Exit) { ui.show("application %s", exit) }
+
+// ShowHookFailed is called when a hook failed that is allowed to fail
+func (ui *VerboseTerminal) ShowHookFailed(err error) { ui.show("warning: %v", err) }
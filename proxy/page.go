@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"html/template"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/wirebase/wire/runner"
+)
+
+// page is the data for any page, it includes the reload script if enabled
+type page struct {
+	Reload bool
+	Data   interface{}
+}
+
+// unavailablePage is rendered when the application can't be reached
+type unavailablePage struct {
+	Err    string
+	Output []runner.Line
+}
+
+// buildErrPage is rendered when the build failed
+type buildErrPage struct {
+	Dir   string
+	Lines []buildErrLine
+}
+
+// buildErrLine is a single line of the compiler output, if it refers to a
+// position in a source file it has a link to it
+type buildErrLine struct {
+	Pos  string
+	Link template.URL
+	Text string
+}
+
+// posExp matches compiler output such as: './main.go:5:2: undefined: x'
+var posExp = regexp.MustCompile(`^(\S+\.go):(\d+)(?::(\d+))?:(.*)$`)
+
+// parseBuildMsg splits the compiler output into lines and links every position
+// it finds using the editor url template
+func parseBuildMsg(dir, msg, editor string) (lines []buildErrLine) {
+	for _, l := range strings.Split(strings.TrimSpace(msg), "\n") {
+		m := posExp.FindStringSubmatch(l)
+		if m == nil {
+			lines = append(lines, buildErrLine{Text: l})
+			continue
+		}
+
+		file := m[1]
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+
+		col := m[3]
+		if col == "" {
+			col = "1"
+		}
+
+		pos := m[1] + ":" + m[2]
+		if m[3] != "" {
+			pos += ":" + m[3]
+		}
+
+		lines = append(lines, buildErrLine{
+			Pos:  pos,
+			Link: template.URL(strings.NewReplacer("{file}", file, "{line}", m[2], "{col}", col).Replace(editor)),
+			Text: m[4],
+		})
+	}
+
+	return
+}
+
+var pages = template.Must(template.New("").Parse(`
+{{define "head"}}<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<title>{{.}}</title>
+	<style>
+		body { font-family: sans-serif; margin: 2em; color: #222; }
+		pre { background: #fdf0f0; border-left: 4px solid #d33; padding: 1em; overflow-x: auto; }
+		a { color: #d33; }
+	</style>
+</head>
+<body>
+{{end}}
+
+{{define "foot"}}{{if .}}<script src="/_wire/reload.js"></script>
+{{end}}</body>
+</html>
+{{end}}
+
+{{define "build"}}{{template "head" "Build failed"}}{{with .Data}}
+<h1>Build failed</h1>
+<p>Failed to build <code>{{.Dir}}</code>, the page will show the application again once the error is fixed.</p>
+<pre>{{range .Lines}}{{if .Pos}}<a href="{{.Link}}">{{.Pos}}</a>:{{end}}{{.Text}}
+{{end}}</pre>
+{{end}}{{template "foot" .Reload}}{{end}}
+
+{{define "error"}}{{template "head" "Error"}}
+<h1>Error</h1>
+<pre>{{.Data}}</pre>
+{{template "foot" .Reload}}{{end}}
+
+{{define "unavailable"}}{{template "head" "Waiting for server"}}
+<meta http-equiv="refresh" content="1">
+<h1>Waiting for server</h1>
+<p>The application is not reachable (yet), it might still be starting. Make sure it listens on the address from the <code>PORT</code> environment variable.</p>
+<pre>{{.Data.Err}}</pre>
+{{with .Data.Output}}<h2>Recent output</h2>
+<pre>{{range .}}{{.Text}}
+{{end}}</pre>
+{{end}}{{template "foot" .Reload}}{{end}}
+`))
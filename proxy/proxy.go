@@ -0,0 +1,157 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+
+	"github.com/wirebase/wire/compile"
+	"github.com/wirebase/wire/runner"
+)
+
+// Config configures the development proxy
+type Config struct {
+
+	// Addr is the address on which the proxy listens for requests, this is
+	// only read when the development server starts. If it is empty no proxy
+	// will be started.
+	Addr string
+
+	// EditorURL is used to link to source files in the error page. The
+	// placeholders {file}, {line} and {col} are replaced by the absolute path,
+	// the line and the column of the error. Defaults to 'file://{file}'
+	EditorURL string
+
+	// DisableReload stops the proxy from injecting a script into html pages
+	// that reloads them whenever the project was rebuild.
+	DisableReload bool
+}
+
+// Proxy is a http handler that forwards requests to the process that is
+// being developed. If the last build failed it will show the error instead.
+// Unless disabled, html pages are reloaded by the browser whenever Reload is
+// called.
+type Proxy struct {
+	rp       *httputil.ReverseProxy
+	upstream string
+	editor   string
+	reload   bool
+	reloads  broker
+
+	mu     sync.RWMutex
+	err    error
+	output func() []runner.Line
+}
+
+// New creates a proxy that forwards requests to the 'upstream' host address
+func New(upstream string, cfg Config) (p *Proxy) {
+	p = &Proxy{upstream: upstream, editor: cfg.EditorURL, reload: !cfg.DisableReload}
+	if p.editor == "" {
+		p.editor = "file://{file}"
+	}
+
+	p.rp = httputil.NewSingleHostReverseProxy(&url.URL{Scheme: "http", Host: upstream})
+	p.rp.ErrorHandler = p.handleUpstreamErr
+	if p.reload {
+
+		// the transport only decompresses responses transparently when it asked
+		// for compression itself, so drop the client's Accept-Encoding to be able
+		// to inject the reload script into html pages
+		direct := p.rp.Director
+		p.rp.Director = func(r *http.Request) {
+			direct(r)
+			r.Header.Del("Accept-Encoding")
+		}
+
+		p.rp.ModifyResponse = injectReload
+	}
+
+	return
+}
+
+// SetErr will cause the proxy to show the error instead of forwarding requests,
+// setting it to nil will start forwarding requests again.
+func (p *Proxy) SetErr(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+}
+
+// SetOutput configures where the proxy gets the recent output of the application
+// from, it is shown when the application can't be reached.
+func (p *Proxy) SetOutput(f func() []runner.Line) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.output = f
+}
+
+// recentOutput returns the recent output of the application, if any
+func (p *Proxy) recentOutput() []runner.Line {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.output == nil {
+		return nil
+	}
+
+	return p.output()
+}
+
+// Err returns the error that is currently shown, if any
+func (p *Proxy) Err() error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.err
+}
+
+// ServeHTTP forwards the request or shows the last error
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if p.reload {
+		switch r.URL.Path {
+		case reloadPath:
+			p.handleReloadScript(w, r)
+			return
+		case eventsPath:
+			p.handleEvents(w, r)
+			return
+		}
+	}
+
+	if err := p.Err(); err != nil {
+		p.renderErr(w, err)
+		return
+	}
+
+	p.rp.ServeHTTP(w, r)
+}
+
+// handleUpstreamErr is called when the process couldn't be reached, most
+// likely because it is (re)starting or because it isn't listening at all
+func (p *Proxy) handleUpstreamErr(w http.ResponseWriter, r *http.Request, err error) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusBadGateway)
+	pages.ExecuteTemplate(w, "unavailable", page{p.reload, unavailablePage{
+		Err:    err.Error(),
+		Output: p.recentOutput(),
+	}})
+}
+
+// renderErr renders the error page
+func (p *Proxy) renderErr(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusInternalServerError)
+
+	var berr compile.BuildErr
+	if errors.As(err, &berr) {
+		pages.ExecuteTemplate(w, "build", page{p.reload, buildErrPage{
+			Dir:   berr.Dir,
+			Lines: parseBuildMsg(berr.Dir, berr.Msg, p.editor),
+		}})
+		return
+	}
+
+	pages.ExecuteTemplate(w, "error", page{p.reload, err.Error()})
+}
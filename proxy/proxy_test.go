@@ -0,0 +1,144 @@
+package proxy_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/wirebase/wire/compile"
+	"github.com/wirebase/wire/proxy"
+)
+
+func get(tb testing.TB, h http.Handler, path string) (code int, body string) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", path, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	h.ServeHTTP(rec, req)
+	b, _ := ioutil.ReadAll(rec.Body)
+	return rec.Code, string(b)
+}
+
+func TestProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello from " + r.URL.Path))
+	}))
+	defer upstream.Close()
+
+	p := proxy.New(strings.TrimPrefix(upstream.URL, "http://"), proxy.Config{
+		EditorURL: "vscode://file{file}:{line}:{col}",
+	})
+
+	t.Run("forward", func(t *testing.T) {
+		code, body := get(t, p, "/foo")
+		if code != http.StatusOK || body != "hello from /foo" {
+			t.Fatalf("expected request to be forwarded, got: %d %s", code, body)
+		}
+	})
+
+	t.Run("build error", func(t *testing.T) {
+		p.SetErr(compile.BuildErr{Dir: "/app", Msg: "# app\n./main.go:4:26: syntax error: unexpected }\n"})
+
+		code, body := get(t, p, "/foo")
+		if code != http.StatusInternalServerError {
+			t.Fatalf("expected error status, got: %d", code)
+		}
+
+		if !strings.Contains(body, `<a href="vscode://file/app/main.go:4:26">./main.go:4:26</a>: syntax error: unexpected }`) {
+			t.Fatalf("expected linked build error, got: %s", body)
+		}
+	})
+
+	t.Run("other error", func(t *testing.T) {
+		p.SetErr(errors.New("<failed>"))
+
+		code, body := get(t, p, "/foo")
+		if code != http.StatusInternalServerError || !strings.Contains(body, "&lt;failed&gt;") {
+			t.Fatalf("expected escaped error, got: %d %s", code, body)
+		}
+	})
+
+	t.Run("recovered", func(t *testing.T) {
+		p.SetErr(nil)
+
+		code, body := get(t, p, "/foo")
+		if code != http.StatusOK || body != "hello from /foo" {
+			t.Fatalf("expected request to be forwarded again, got: %d %s", code, body)
+		}
+	})
+
+	t.Run("unavailable", func(t *testing.T) {
+		upstream.Close()
+
+		code, body := get(t, p, "/foo")
+		if code != http.StatusBadGateway || !strings.Contains(body, "Waiting for server") {
+			t.Fatalf("expected waiting page, got: %d %s", code, body)
+		}
+	})
+}
+
+func TestLiveReload(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html><body><p>hi</p></body></html>"))
+		default:
+			w.Write([]byte("body { }"))
+		}
+	}))
+	defer upstream.Close()
+
+	p := proxy.New(strings.TrimPrefix(upstream.URL, "http://"), proxy.Config{})
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+
+	t.Run("inject html", func(t *testing.T) {
+		code, body := get(t, p, "/page")
+		if code != http.StatusOK || body != `<html><body><p>hi</p><script src="/_wire/reload.js"></script></body></html>` {
+			t.Fatalf("expected script to be injected, got: %d %s", code, body)
+		}
+	})
+
+	t.Run("leave other content", func(t *testing.T) {
+		_, body := get(t, p, "/style.css")
+		if body != "body { }" {
+			t.Fatalf("expected body to be unmodified, got: %s", body)
+		}
+	})
+
+	t.Run("reload event", func(t *testing.T) {
+		resp, err := http.Get(srv.URL + "/_wire/events")
+		if err != nil {
+			t.Fatalf("failed to listen for events: %v", err)
+		}
+
+		defer resp.Body.Close()
+		if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Fatalf("expected event stream, got: %v", ct)
+		}
+
+		p.Reload()
+
+		buf := make([]byte, 512)
+		var got string
+		for !strings.Contains(got, "event: reload") {
+			n, err := resp.Body.Read(buf)
+			if err != nil {
+				t.Fatalf("failed to read event, got: %v (read: %q)", err, got)
+			}
+
+			got += string(buf[:n])
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		p := proxy.New(strings.TrimPrefix(upstream.URL, "http://"), proxy.Config{DisableReload: true})
+		_, body := get(t, p, "/page")
+		if strings.Contains(body, "reload.js") {
+			t.Fatalf("expected no script to be injected, got: %s", body)
+		}
+	})
+}
@@ -0,0 +1,162 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// reloadPath is the path at which the live reload script is served
+	reloadPath = "/_wire/reload.js"
+
+	// eventsPath is the path at which the browser listens for server-sent events
+	eventsPath = "/_wire/events"
+)
+
+// reloadScript is injected into every html page, it reloads the page whenever
+// the development server reports that a rebuild has finished.
+var reloadScript = `(function() {
+	var es = new EventSource("` + eventsPath + `");
+	es.addEventListener("reload", function() { location.reload(); });
+})();
+`
+
+// reloadTag is the html that is inserted into every page
+var reloadTag = []byte(`<script src="` + reloadPath + `"></script>`)
+
+// broker fans out reload events to all browsers that are listening
+type broker struct {
+	mu   sync.Mutex
+	subs map[chan struct{}]struct{}
+}
+
+// subscribe returns a channel that receives a value for every reload
+func (b *broker) subscribe() chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subs == nil {
+		b.subs = make(map[chan struct{}]struct{})
+	}
+
+	ch := make(chan struct{}, 1)
+	b.subs[ch] = struct{}{}
+	return ch
+}
+
+// unsubscribe stops sending reloads to 'ch'
+func (b *broker) unsubscribe(ch chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subs, ch)
+}
+
+// publish a reload to all subscribers, subscribers that still have a reload
+// pending will not receive another one
+func (b *broker) publish() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Reload tells every browser that has a page open to reload it. Unless an
+// error is shown, it first waits (up to a second) for the application to
+// accept connections such that the browser doesn't reload too early.
+func (p *Proxy) Reload() {
+	if p.Err() != nil {
+		p.reloads.publish()
+		return
+	}
+
+	go func() {
+		for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+			conn, err := net.DialTimeout("tcp", p.upstream, time.Millisecond*100)
+			if err == nil {
+				conn.Close()
+				break
+			}
+
+			time.Sleep(time.Millisecond * 25)
+		}
+
+		p.reloads.publish()
+	}()
+}
+
+// handleEvents streams reload events to the browser
+func (p *Proxy) handleEvents(w http.ResponseWriter, r *http.Request) {
+	f, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	ch := p.reloads.subscribe()
+	defer p.reloads.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintf(w, ": connected\n\n")
+	f.Flush()
+
+	for {
+		select {
+		case <-ch:
+			fmt.Fprintf(w, "event: reload\ndata: \n\n")
+			f.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// handleReloadScript serves the script that listens for reload events
+func (p *Proxy) handleReloadScript(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/javascript")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(reloadScript))
+}
+
+// injectReload is used to modify responses from the application such that
+// html pages include the live reload script.
+func injectReload(resp *http.Response) (err error) {
+	ct := resp.Header.Get("Content-Type")
+	if !strings.HasPrefix(ct, "text/html") || resp.Header.Get("Content-Encoding") != "" {
+		return nil
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	resp.Body.Close()
+
+	// insert before the closing body tag or append if it isn't there
+	var buf bytes.Buffer
+	if i := bytes.LastIndex(bytes.ToLower(body), []byte("</body>")); i >= 0 {
+		buf.Write(body[:i])
+		buf.Write(reloadTag)
+		buf.Write(body[i:])
+	} else {
+		buf.Write(body)
+		buf.Write(reloadTag)
+	}
+
+	resp.Body = ioutil.NopCloser(&buf)
+	resp.ContentLength = int64(buf.Len())
+	resp.Header.Set("Content-Length", strconv.Itoa(buf.Len()))
+	resp.Header.Del("Etag")
+	return nil
+}
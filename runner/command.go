@@ -0,0 +1,73 @@
+package runner
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// DefaultCommandTimeout is how long RunCommand allows a command to run if no
+// timeout is provided
+const DefaultCommandTimeout = time.Second * 30
+
+// lockedBuffer is a buffer that can be read while the command still writes it
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// RunCommand runs 'cmd' to completion and returns what it wrote to stdout and
+// stderr, when it fails the output is part of the error. The command runs in
+// its own process group such that any children it started are killed with it
+// when it takes longer than 'timeout'.
+func RunCommand(cmd *exec.Cmd, timeout time.Duration) (out string, err error) {
+	if timeout <= 0 {
+		timeout = DefaultCommandTimeout
+	}
+
+	buf := &lockedBuffer{}
+	cmd.Stdout, cmd.Stderr = buf, buf
+	setProcessGroup(cmd)
+	err = cmd.Start()
+	if err != nil {
+		return "", fmt.Errorf("%w:\n", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	select {
+	case err = <-done:
+	case <-time.After(timeout):
+
+		// children that escaped the group may keep the output open, which keeps
+		// waiting from returning, so it is only waited on for so long
+		killGroup(cmd.Process)
+		select {
+		case <-done:
+		case <-time.After(KillWait):
+		}
+
+		return buf.String(), fmt.Errorf("timed out after %s:\n%s", timeout, buf.String())
+	}
+
+	if err != nil {
+		return buf.String(), fmt.Errorf("%w:\n%s", err, buf.String())
+	}
+
+	return buf.String(), nil
+}
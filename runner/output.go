@@ -0,0 +1,134 @@
+package runner
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+)
+
+// Stream identifies the output stream of a process
+type Stream string
+
+const (
+	// Stdout is the standard output of the process
+	Stdout Stream = "stdout"
+
+	// Stderr is the standard error of the process
+	Stderr Stream = "stderr"
+)
+
+// Line is a single line of output written by the process
+type Line struct {
+	Stream Stream
+	Time   time.Time
+	Text   string
+}
+
+// ansi color codes for the prefix of each stream
+var colors = map[Stream]string{Stdout: "\x1b[36m", Stderr: "\x1b[33m"}
+
+// output collects the lines written by processes, writes them to the
+// underlying writer and keeps the last lines around
+type output struct {
+	mu    sync.Mutex
+	w     io.Writer
+	lines []Line
+	next  int // position in lines where the next line is stored
+	full  bool
+}
+
+// newOutput creates an output that keeps at most 'n' lines
+func newOutput(w io.Writer, n int) *output {
+	return &output{w: w, lines: make([]Line, n)}
+}
+
+// setWriter changes the writer that lines are written to
+func (o *output) setWriter(w io.Writer) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.w = w
+}
+
+// add a line of output, it is written with the prefix in a single write
+// such that it doesn't get mixed up with other output to the same writer
+func (o *output) add(l Line, prefix string, color bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if len(o.lines) > 0 {
+		o.lines[o.next] = l
+		o.next = (o.next + 1) % len(o.lines)
+		o.full = o.full || o.next == 0
+	}
+
+	if o.w == nil {
+		return
+	}
+
+	var buf bytes.Buffer
+	if prefix != "" && color {
+		buf.WriteString(colors[l.Stream] + prefix + "\x1b[0m")
+	} else {
+		buf.WriteString(prefix)
+	}
+
+	buf.WriteString(l.Text)
+	buf.WriteByte('\n')
+	o.w.Write(buf.Bytes())
+}
+
+// last returns the lines that were kept, oldest first
+func (o *output) last() (lines []Line) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.full {
+		lines = append(lines, o.lines[o.next:]...)
+	}
+
+	return append(lines, o.lines[:o.next]...)
+}
+
+// lineWriter splits whatever is written to it into lines and adds them to
+// the output
+type lineWriter struct {
+	out    *output
+	stream Stream
+	prefix string
+	color  bool
+	buf    []byte
+}
+
+// Write splits 'p' into lines, any trailing partial line is kept until the
+// rest of it is written or the writer is flushed
+func (lw *lineWriter) Write(p []byte) (n int, err error) {
+	lw.buf = append(lw.buf, p...)
+	for {
+		i := bytes.IndexByte(lw.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		lw.emit(lw.buf[:i])
+		lw.buf = lw.buf[i+1:]
+	}
+
+	return len(p), nil
+}
+
+// flush any partial line that is left
+func (lw *lineWriter) flush() {
+	if len(lw.buf) > 0 {
+		lw.emit(lw.buf)
+		lw.buf = nil
+	}
+}
+
+func (lw *lineWriter) emit(b []byte) {
+	lw.out.add(Line{
+		Stream: lw.stream,
+		Time:   time.Now(),
+		Text:   string(bytes.TrimSuffix(b, []byte{'\r'})),
+	}, lw.prefix, lw.color)
+}
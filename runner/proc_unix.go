@@ -0,0 +1,53 @@
+//go:build !windows
+// +build !windows
+
+package runner
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// signals maps the names of signals that can be used to stop the process
+var signals = map[string]syscall.Signal{
+	"SIGTERM": syscall.SIGTERM,
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+	"SIGKILL": syscall.SIGKILL,
+}
+
+// parseSignal returns the signal with the provided name
+func parseSignal(name string) (os.Signal, error) {
+	sig, ok := signals[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported stop signal '%s'", name)
+	}
+
+	return sig, nil
+}
+
+// setProcessGroup makes the process the leader of a new process group, such
+// that it can be stopped together with any children it starts
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// signalGroup sends a signal to the process group led by 'proc'
+func signalGroup(proc *os.Process, sig os.Signal) error {
+	err := syscall.Kill(-proc.Pid, sig.(syscall.Signal))
+	if err == syscall.ESRCH {
+		return nil // already gone
+	}
+
+	return err
+}
+
+// killGroup kills all processes in the group led by 'proc'
+func killGroup(proc *os.Process) error {
+	return signalGroup(proc, syscall.SIGKILL)
+}
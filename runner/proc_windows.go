@@ -0,0 +1,36 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// parseSignal returns the signal with the provided name, on windows processes
+// can only be killed
+func parseSignal(name string) (os.Signal, error) {
+	switch name {
+	case "SIGKILL", "SIGTERM", "SIGINT":
+		return os.Kill, nil
+	default:
+		return nil, fmt.Errorf("unsupported stop signal '%s'", name)
+	}
+}
+
+// setProcessGroup is a no-op on windows
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// signalGroup kills the process, there is no graceful shutdown on windows
+func signalGroup(proc *os.Process, sig os.Signal) error {
+	return killGroup(proc)
+}
+
+// killGroup kills the process, any children it started are left running
+func killGroup(proc *os.Process) error {
+	err := proc.Kill()
+	if err != nil && err != os.ErrProcessDone {
+		return err
+	}
+
+	return nil
+}
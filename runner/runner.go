@@ -2,8 +2,27 @@ package runner
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"sync"
+	"time"
+)
+
+// RestartPolicy determines if a process is restarted after it exited by itself
+type RestartPolicy string
+
+const (
+	// RestartNever will not restart the process, it runs again on the next change
+	RestartNever RestartPolicy = "never"
+
+	// RestartOnFailure restarts the process if it exited with a non-zero exit
+	// code, with an exponential backoff between consecutive failures
+	RestartOnFailure RestartPolicy = "on-failure"
+
+	// RestartAlways restarts the process whenever it exits, with an exponential
+	// backoff between consecutive failures
+	RestartAlways RestartPolicy = "always"
 )
 
 // Config configures the running of processes
@@ -16,27 +35,234 @@ type Config struct {
 	// the to existing environment variables before being passed to
 	// the process
 	Env []string
+
+	// Restart configures if the process is restarted after it exited by
+	// itself, defaults to 'never'.
+	Restart RestartPolicy
+
+	// MinBackoff is the time waited before the first restart after a failure,
+	// it doubles on every consecutive failure. Defaults to 100ms
+	MinBackoff time.Duration
+
+	// MaxBackoff is the longest time waited before restarting, Defaults to 10s
+	MaxBackoff time.Duration
+
+	// MinUptime is how long a process must run before an exit with a failure
+	// is no longer considered a crash. Defaults to 1s
+	MinUptime time.Duration
+
+	// MaxCrashes is the number of consecutive crashes after which restarts are
+	// suppressed until the process is run again. Defaults to 3
+	MaxCrashes int
+
+	// StopSignal is the name of the signal that is send to the process group
+	// to ask it to shut down, i.e: SIGTERM, SIGINT. Defaults to SIGTERM.
+	StopSignal string
+
+	// StopTimeout is how long the process is given to shut down gracefully
+	// before it is killed. Defaults to 5s
+	StopTimeout time.Duration
+
+	// Prefix is written in front of every line the process writes to its
+	// stdout or stderr, i.e: '[serve] '.
+	Prefix string
+
+	// Color will color the prefix differently for stdout and stderr
+	Color bool
+}
+
+// withDefaults returns the config with defaults filled in for empty values
+func (cfg Config) withDefaults() Config {
+	if cfg.Restart == "" {
+		cfg.Restart = RestartNever
+	}
+
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = time.Millisecond * 100
+	}
+
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = time.Second * 10
+	}
+
+	if cfg.MinUptime <= 0 {
+		cfg.MinUptime = time.Second
+	}
+
+	if cfg.MaxCrashes <= 0 {
+		cfg.MaxCrashes = 3
+	}
+
+	if cfg.StopSignal == "" {
+		cfg.StopSignal = "SIGTERM"
+	}
+
+	if cfg.StopTimeout <= 0 {
+		cfg.StopTimeout = time.Second * 5
+	}
+
+	return cfg
+}
+
+// Validate checks the configuration for values that can't work
+func (cfg Config) Validate() error {
+	switch cfg.Restart {
+	case "", RestartNever, RestartOnFailure, RestartAlways:
+	default:
+		return fmt.Errorf("unknown restart policy '%s'", cfg.Restart)
+	}
+
+	if cfg.StopSignal != "" {
+		if _, err := parseSignal(cfg.StopSignal); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Exit describes a process that exited by itself
+type Exit struct {
+
+	// Code is the exit code of the process, or -1 if it was terminated by a signal
+	Code int
+
+	// Uptime is how long the process has been running
+	Uptime time.Duration
+
+	// Crashed is true if the process failed before it ran for the minimum uptime
+	Crashed bool
+
+	// Restart is how long the runner will wait before restarting the process,
+	// zero if the process won't be restarted.
+	Restart time.Duration
+
+	// Suppressed is true if the process crashed too often in a row, it won't be
+	// restarted until it is run again.
+	Suppressed bool
+
+	// Err is set if restarting the process after an earlier exit failed, the
+	// other fields are empty in that case. It won't be restarted until it is
+	// run again.
+	Err error
+}
+
+func (e Exit) String() string {
+	switch {
+	case e.Err != nil:
+		return fmt.Sprintf("failed to restart: %v", e.Err)
+	case e.Suppressed:
+		return fmt.Sprintf("exited with code %d after %s, crashed too often: not restarting until something changes", e.Code, e.Uptime.Round(time.Millisecond))
+	case e.Restart > 0:
+		return fmt.Sprintf("exited with code %d after %s, restarting in %s", e.Code, e.Uptime.Round(time.Millisecond), e.Restart)
+	default:
+		return fmt.Sprintf("exited with code %d after %s", e.Code, e.Uptime.Round(time.Millisecond))
+	}
+}
+
+// process is a single run of the binary
+type process struct {
+	cmd     *exec.Cmd
+	stdout  *lineWriter
+	stderr  *lineWriter
+	started time.Time
+	done    chan struct{} // closed when the process has exited
+	stopped bool          // set when the process is killed on purpose
 }
 
 // Runner manages (re)running the serving binary whenever something changes
-type Runner struct{ cmd *exec.Cmd }
+type Runner struct {
+	mu       sync.Mutex
+	proc     *process
+	binp     string
+	cfg      Config
+	failures int // consecutive failures, determines the backoff
+	crashes  int // consecutive crashes, determines the suppression
+	exits    chan Exit
+	restart  *time.Timer
+	out      *output
+}
 
-// New initiales a new runner
+// KeepLines is the number of output lines the runner keeps around
+const KeepLines = 200
+
+// KillWait is how long the runner waits for a killed process to end
+const KillWait = time.Second
+
+// New initiales a new runner, output of the process is written to stderr
 func New() *Runner {
-	return &Runner{}
+	return &Runner{exits: make(chan Exit, 10), out: newOutput(os.Stderr, KeepLines)}
 }
 
+// SetOutput changes where the output of the process is written to, lines are
+// written one at a time such that the output can safely be shared with other
+// writers that do the same. If it is nil the output is only kept.
+func (r *Runner) SetOutput(w io.Writer) { r.out.setWriter(w) }
+
+// Output returns the last lines the process(es) wrote to stdout and stderr,
+// oldest first.
+func (r *Runner) Output() []Line { return r.out.last() }
+
+// Exits returns a channel that receives every time the process exits by
+// itself, or fails to restart. If the channel is not read, exits are dropped.
+func (r *Runner) Exits() <-chan Exit { return r.exits }
+
 // Kill the currently running process, if there is no process running this
-// method is a no-op
+// method is a no-op. The process is given the configured time to shut down
+// after receiving the stop signal before it is killed.
 func (r *Runner) Kill() (err error) {
-	if r.cmd != nil {
-		err = r.cmd.Process.Kill()
-		if err != nil {
-			return fmt.Errorf("failed to kill process: %w", err)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.kill()
+}
+
+// kill stops the current process and any pending restart, the lock must be held
+func (r *Runner) kill() (err error) {
+	if r.restart != nil {
+		r.restart.Stop()
+		r.restart = nil
+	}
+
+	if r.proc == nil {
+		return nil
+	}
+
+	// ask the process to stop gracefully, unless it already exited by itself.
+	// If it can't be asked it is killed right away.
+	proc := r.proc
+	select {
+	case <-proc.done:
+	default:
+		sig, err := parseSignal(r.cfg.StopSignal)
+		if err == nil {
+			err = signalGroup(proc.cmd.Process, sig)
+		}
+
+		if err == nil {
+			select {
+			case <-proc.done:
+			case <-time.After(r.cfg.StopTimeout):
+			}
 		}
+	}
 
-		// wait for process to end, we do not care what happened to the process
-		r.cmd.Wait()
+	// kill whatever is left of the process group, this includes any children
+	// the process started that didn't stop with it. The process is only
+	// forgotten once it is gone, such that a failure can be retried.
+	err = killGroup(proc.cmd.Process)
+	if err != nil {
+		return fmt.Errorf("failed to kill process: %w", err)
+	}
+
+	proc.stopped = true
+	r.proc = nil
+
+	// wait for process to end, we do not care what happened to the process. A
+	// child that escaped the group may hold on to the output of the process,
+	// which keeps waiting from returning, so it is only waited on for so long.
+	select {
+	case <-proc.done:
+	case <-time.After(KillWait):
 	}
 
 	return
@@ -45,18 +271,121 @@ func (r *Runner) Kill() (err error) {
 // Run a binary at the provided location, if there is already a binary runnig
 // shut it down before starting the new process.
 func (r *Runner) Run(binp string, cfg Config) (err error) {
-	err = r.Kill()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err = cfg.Validate()
+	if err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	err = r.kill()
 	if err != nil {
 		return err
 	}
 
-	r.cmd = exec.Command(binp, cfg.Args...)
-	r.cmd.Env = append(os.Environ(), cfg.Env...)
-	r.cmd.Stderr = os.Stderr
-	err = r.cmd.Start()
+	// a new run, i.e. something changed, so the process gets a fresh start
+	r.binp, r.cfg = binp, cfg.withDefaults()
+	r.failures, r.crashes = 0, 0
+	return r.start()
+}
+
+// start the binary as a new process, the lock must be held
+func (r *Runner) start() (err error) {
+	cmd := exec.Command(r.binp, r.cfg.Args...)
+	cmd.Env = append(os.Environ(), r.cfg.Env...)
+	proc := &process{
+		cmd:    cmd,
+		stdout: &lineWriter{out: r.out, stream: Stdout, prefix: r.cfg.Prefix, color: r.cfg.Color},
+		stderr: &lineWriter{out: r.out, stream: Stderr, prefix: r.cfg.Prefix, color: r.cfg.Color},
+		done:   make(chan struct{}),
+	}
+
+	cmd.Stdout, cmd.Stderr = proc.stdout, proc.stderr
+	setProcessGroup(cmd)
+	err = cmd.Start()
 	if err != nil {
 		return fmt.Errorf("failed to start process: %w", err)
 	}
 
+	proc.started = time.Now()
+	r.proc = proc
+	go r.wait(r.proc)
 	return nil
 }
+
+// wait for the process to exit and determine if it should be restarted
+func (r *Runner) wait(proc *process) {
+	proc.cmd.Wait()
+	proc.stdout.flush()
+	proc.stderr.flush()
+	close(proc.done)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if proc.stopped || r.proc != proc {
+		return // killed on purpose
+	}
+
+	exit := Exit{Code: proc.cmd.ProcessState.ExitCode(), Uptime: time.Since(proc.started)}
+	if exit.Code != 0 {
+		r.failures++
+		if exit.Uptime < r.cfg.MinUptime {
+			exit.Crashed = true
+			r.crashes++
+		} else {
+			r.crashes = 0
+		}
+	} else {
+		r.failures, r.crashes = 0, 0
+	}
+
+	switch {
+	case r.crashes >= r.cfg.MaxCrashes:
+		exit.Suppressed = true
+	case r.cfg.Restart == RestartAlways, r.cfg.Restart == RestartOnFailure && exit.Code != 0:
+		exit.Restart = r.backoff()
+		r.restart = time.AfterFunc(exit.Restart, func() { r.restartProc(proc) })
+	}
+
+	r.report(exit)
+}
+
+// report an exit, it is dropped if the exits channel isn't read
+func (r *Runner) report(exit Exit) {
+	select {
+	case r.exits <- exit:
+	default:
+	}
+}
+
+// backoff returns how long to wait before the next restart
+func (r *Runner) backoff() (d time.Duration) {
+	d = r.cfg.MinBackoff
+	for i := 1; i < r.failures && d < r.cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+
+	if d > r.cfg.MaxBackoff {
+		d = r.cfg.MaxBackoff
+	}
+
+	return
+}
+
+// restartProc starts the binary again, unless something else happened to the
+// runner since 'proc' exited
+func (r *Runner) restartProc(proc *process) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.proc != proc || proc.stopped {
+		return
+	}
+
+	r.restart = nil
+	err := r.start()
+	if err != nil {
+		r.proc = nil
+		r.report(Exit{Err: err})
+	}
+}
@@ -1,7 +1,17 @@
 package runner_test
 
 import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/wirebase/wire/runner"
 )
@@ -35,3 +45,356 @@ func TestRunningOfQuickProcess(t *testing.T) {
 		}
 	})
 }
+
+func nextExit(tb testing.TB, r *runner.Runner) runner.Exit {
+	select {
+	case exit := <-r.Exits():
+		return exit
+	case <-time.After(time.Second * 5):
+		tb.Fatalf("expected process to exit")
+		return runner.Exit{}
+	}
+}
+
+func TestRestartPolicy(t *testing.T) {
+	t.Run("never", func(t *testing.T) {
+		r := runner.New()
+		defer r.Kill()
+
+		err := r.Run("false", runner.Config{})
+		if err != nil {
+			t.Fatalf("expected run to succeed, got: %v", err)
+		}
+
+		exit := nextExit(t, r)
+		if exit.Code != 1 || !exit.Crashed || exit.Restart != 0 {
+			t.Fatalf("expected crash without restart, got: %+v", exit)
+		}
+	})
+
+	t.Run("on failure with crash loop", func(t *testing.T) {
+		r := runner.New()
+		defer r.Kill()
+
+		cfg := runner.Config{Restart: runner.RestartOnFailure, MinBackoff: time.Millisecond * 10}
+		err := r.Run("false", cfg)
+		if err != nil {
+			t.Fatalf("expected run to succeed, got: %v", err)
+		}
+
+		for _, exp := range []time.Duration{time.Millisecond * 10, time.Millisecond * 20} {
+			if exit := nextExit(t, r); exit.Restart != exp || exit.Suppressed {
+				t.Fatalf("expected restart after %s, got: %+v", exp, exit)
+			}
+		}
+
+		if exit := nextExit(t, r); !exit.Suppressed || exit.Restart != 0 {
+			t.Fatalf("expected restarts to be suppressed, got: %+v", exit)
+		}
+
+		// running again, i.e. something changed, starts from scratch
+		err = r.Run("false", cfg)
+		if err != nil {
+			t.Fatalf("expected run to succeed, got: %v", err)
+		}
+
+		if exit := nextExit(t, r); exit.Restart != time.Millisecond*10 {
+			t.Fatalf("expected backoff to be reset, got: %+v", exit)
+		}
+	})
+
+	t.Run("always", func(t *testing.T) {
+		r := runner.New()
+		defer r.Kill()
+
+		err := r.Run("true", runner.Config{Restart: runner.RestartAlways, MinBackoff: time.Millisecond})
+		if err != nil {
+			t.Fatalf("expected run to succeed, got: %v", err)
+		}
+
+		for i := 0; i < 5; i++ {
+			if exit := nextExit(t, r); exit.Code != 0 || exit.Crashed || exit.Restart != time.Millisecond {
+				t.Fatalf("expected successful exit to be restarted, got: %+v", exit)
+			}
+		}
+	})
+
+	t.Run("failed restart", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "tl_runner_")
+		if err != nil {
+			t.Fatalf("failed to create temp dir: %v", err)
+		}
+
+		defer os.RemoveAll(dir)
+		binp := filepath.Join(dir, "app.sh")
+		ioutil.WriteFile(binp, []byte("#!/bin/sh\nrm \"$0\"\nexit 1\n"), 0777)
+
+		r := runner.New()
+		defer r.Kill()
+
+		err = r.Run(binp, runner.Config{Restart: runner.RestartAlways, MinBackoff: time.Millisecond * 10})
+		if err != nil {
+			t.Fatalf("expected run to succeed, got: %v", err)
+		}
+
+		if exit := nextExit(t, r); exit.Restart == 0 {
+			t.Fatalf("expected restart, got: %+v", exit)
+		}
+
+		if exit := nextExit(t, r); exit.Err == nil || !strings.HasPrefix(exit.String(), "failed to restart: ") {
+			t.Fatalf("expected restart failure to be reported, got: %+v", exit)
+		}
+	})
+
+	t.Run("killed", func(t *testing.T) {
+		r := runner.New()
+		err := r.Run("sleep", runner.Config{Args: []string{"300"}, Restart: runner.RestartAlways})
+		if err != nil {
+			t.Fatalf("expected run to succeed, got: %v", err)
+		}
+
+		err = r.Kill()
+		if err != nil {
+			t.Fatalf("failed to kill: %v", err)
+		}
+
+		select {
+		case exit := <-r.Exits():
+			t.Fatalf("expected no exit to be reported when killed, got: %+v", exit)
+		case <-time.After(time.Millisecond * 50):
+		}
+	})
+}
+
+func TestGracefulStop(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tl_runner_")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	t.Run("stop signal", func(t *testing.T) {
+		p := filepath.Join(dir, "stopped")
+		r := runner.New()
+		err := r.Run("sh", runner.Config{Args: []string{"-c", `trap "echo bye > ` + p + `; exit 0" TERM; sleep 300 & wait`}})
+		if err != nil {
+			t.Fatalf("expected run to succeed, got: %v", err)
+		}
+
+		time.Sleep(time.Millisecond * 100) // give the shell time to setup the trap
+		err = r.Kill()
+		if err != nil {
+			t.Fatalf("failed to kill: %v", err)
+		}
+
+		if b, _ := ioutil.ReadFile(p); string(b) != "bye\n" {
+			t.Fatalf("expected process to shut down gracefully, got: %q", b)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		r := runner.New()
+		err := r.Run("sh", runner.Config{
+			Args:        []string{"-c", `trap "" TERM; sleep 300 & wait`},
+			StopTimeout: time.Millisecond * 100,
+		})
+		if err != nil {
+			t.Fatalf("expected run to succeed, got: %v", err)
+		}
+
+		time.Sleep(time.Millisecond * 100)
+		start := time.Now()
+		err = r.Kill()
+		if err != nil {
+			t.Fatalf("failed to kill: %v", err)
+		}
+
+		if time.Since(start) > time.Second {
+			t.Fatalf("expected process to be killed after the timeout, took: %s", time.Since(start))
+		}
+	})
+
+	t.Run("children", func(t *testing.T) {
+		p := filepath.Join(dir, "child.pid")
+		r := runner.New()
+		err := r.Run("sh", runner.Config{Args: []string{"-c", `sleep 300 & echo $! > ` + p + `; wait`}})
+		if err != nil {
+			t.Fatalf("expected run to succeed, got: %v", err)
+		}
+
+		pid := readPid(t, p)
+		err = r.Kill()
+		if err != nil {
+			t.Fatalf("failed to kill: %v", err)
+		}
+
+		waitGone(t, pid)
+	})
+
+	t.Run("escaped child", func(t *testing.T) {
+		if _, err := exec.LookPath("setsid"); err != nil {
+			t.Skip("setsid is not available")
+		}
+
+		// the child leaves the process group but keeps the output open
+		p := filepath.Join(dir, "escaped.pid")
+		r := runner.New()
+		err := r.Run("sh", runner.Config{
+			Args:        []string{"-c", `setsid sh -c 'echo $$ > ` + p + `; exec sleep 300' & wait`},
+			StopTimeout: time.Millisecond * 100,
+		})
+		if err != nil {
+			t.Fatalf("expected run to succeed, got: %v", err)
+		}
+
+		pid := readPid(t, p)
+		defer func() {
+			if proc, err := os.FindProcess(pid); err == nil {
+				proc.Kill()
+			}
+		}()
+
+		start := time.Now()
+		err = r.Kill()
+		if err != nil {
+			t.Fatalf("failed to kill: %v", err)
+		}
+
+		if time.Since(start) > runner.KillWait*2 {
+			t.Fatalf("expected kill to return after the wait, took: %s", time.Since(start))
+		}
+	})
+
+	t.Run("invalid signal", func(t *testing.T) {
+		err := runner.Config{StopSignal: "SIGFOO"}.Validate()
+		if err == nil {
+			t.Fatalf("expected invalid signal to fail validation")
+		}
+
+		// the running process is left alone, it can still be stopped
+		r := runner.New()
+		err = r.Run("sleep", runner.Config{Args: []string{"300"}})
+		if err != nil {
+			t.Fatalf("expected run to succeed, got: %v", err)
+		}
+
+		err = r.Run("sleep", runner.Config{Args: []string{"300"}, StopSignal: "SIGFOO"})
+		if err == nil {
+			t.Fatalf("expected run with invalid signal to fail")
+		}
+
+		err = r.Kill()
+		if err != nil {
+			t.Fatalf("failed to kill: %v", err)
+		}
+	})
+}
+
+// readPid waits for a process to write its pid to file 'p' and returns it
+func readPid(tb testing.TB, p string) int {
+	for start := time.Now(); time.Since(start) < time.Second*5; time.Sleep(time.Millisecond * 10) {
+		b, _ := ioutil.ReadFile(p)
+		if pid, err := strconv.Atoi(strings.TrimSpace(string(b))); err == nil {
+			return pid
+		}
+	}
+
+	tb.Fatalf("expected pid to be written to '%s'", p)
+	return 0
+}
+
+// waitGone waits for the process with 'pid' to no longer run, a zombie that
+// wasn't reaped yet is considered gone
+func waitGone(tb testing.TB, pid int) {
+	for start := time.Now(); time.Since(start) < time.Second*5; time.Sleep(time.Millisecond * 10) {
+		proc, err := os.FindProcess(pid)
+		if err != nil || proc.Signal(syscall.Signal(0)) != nil {
+			return
+		}
+
+		stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		if err == nil && strings.Contains(string(stat), ") Z ") {
+			return
+		}
+	}
+
+	tb.Fatalf("expected process %d to be killed", pid)
+}
+
+func TestRunCommand(t *testing.T) {
+	out, err := runner.RunCommand(exec.Command("sh", "-c", "echo hi"), 0)
+	if err != nil || out != "hi\n" {
+		t.Fatalf("expected output, got: %q %v", out, err)
+	}
+
+	_, err = runner.RunCommand(exec.Command("sh", "-c", "echo broken; exit 2"), 0)
+	if err == nil || err.Error() != "exit status 2:\nbroken\n" {
+		t.Fatalf("expected failure with output, got: %v", err)
+	}
+
+	// children of the command are killed with it, or they would keep its
+	// output open until they exit
+	start := time.Now()
+	_, err = runner.RunCommand(exec.Command("sh", "-c", "echo started; sleep 3; true"), time.Millisecond*100)
+	if err == nil || !strings.HasPrefix(err.Error(), "timed out after 100ms:\nstarted") {
+		t.Fatalf("expected timeout, got: %v", err)
+	}
+
+	if time.Since(start) > time.Second {
+		t.Fatalf("expected command to be killed after the timeout, took: %s", time.Since(start))
+	}
+}
+
+func TestOutputCapture(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	r := runner.New()
+	r.SetOutput(buf)
+
+	err := r.Run("sh", runner.Config{
+		Args:   []string{"-c", `echo "out 1"; echo "err 1" >&2; sleep 0.05; printf "out 2"`},
+		Prefix: "[serve] ",
+	})
+	if err != nil {
+		t.Fatalf("expected run to succeed, got: %v", err)
+	}
+
+	nextExit(t, r)
+
+	out := buf.String()
+	for _, exp := range []string{"[serve] out 1\n", "[serve] err 1\n", "[serve] out 2\n"} {
+		if !strings.Contains(out, exp) {
+			t.Fatalf("expected output to contain %q, got: %q", exp, out)
+		}
+	}
+
+	lines := r.Output()
+	if len(lines) != 3 || lines[2].Text != "out 2" || lines[2].Stream != runner.Stdout {
+		t.Fatalf("expected lines to be kept, got: %+v", lines)
+	}
+
+	var streams []runner.Stream
+	for _, l := range lines[:2] {
+		streams = append(streams, l.Stream)
+	}
+
+	if !(streams[0] == runner.Stdout && streams[1] == runner.Stderr) &&
+		!(streams[0] == runner.Stderr && streams[1] == runner.Stdout) {
+		t.Fatalf("expected both streams to be captured, got: %v", streams)
+	}
+
+	t.Run("ring buffer", func(t *testing.T) {
+		r.SetOutput(nil)
+		err := r.Run("sh", runner.Config{Args: []string{"-c", `for i in $(seq 1 250); do echo "line $i"; done`}})
+		if err != nil {
+			t.Fatalf("expected run to succeed, got: %v", err)
+		}
+
+		nextExit(t, r)
+
+		lines := r.Output()
+		if len(lines) != runner.KeepLines || lines[len(lines)-1].Text != "line 250" {
+			t.Fatalf("expected only the last lines to be kept, got: %d lines", len(lines))
+		}
+	})
+}
@@ -0,0 +1,92 @@
+package vfsgen
+
+import (
+	"crypto/sha256"
+	"sync"
+)
+
+// Cache holds the encoded content of files across generations, keyed by the
+// hash of their content, such that files that didn't change don't have to be
+// compressed again. A Cache is meant to be reused for generating the same
+// output file, entries that were not used during the last generation are
+// dropped when it completes. The zero value is not usable, use NewCache.
+type Cache struct {
+	mu      sync.Mutex
+	gen     int
+	entries map[cacheKey]*cacheEntry
+}
+
+// cacheKey identifies the content of a file in an encoding.
+type cacheKey struct {
+	sum      [sha256.Size]byte
+	encoding string
+}
+
+// cacheEntry is encoded content and the generation it was last used in.
+type cacheEntry struct {
+	data []byte
+	gen  int
+}
+
+// NewCache returns an empty cache.
+func NewCache() *Cache {
+	return &Cache{entries: map[cacheKey]*cacheEntry{}}
+}
+
+// Len returns the number of encoded contents in the cache.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// begin starts a new generation.
+func (c *Cache) begin() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.gen++
+	c.mu.Unlock()
+}
+
+// sweep drops the entries that were not used in the current generation.
+func (c *Cache) sweep() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	for k, e := range c.entries {
+		if e.gen != c.gen {
+			delete(c.entries, k)
+		}
+	}
+	c.mu.Unlock()
+}
+
+// encode returns data in the named encoding, encoding it with fn only if it is
+// not in the cache. A nil cache always encodes.
+func (c *Cache) encode(encoding string, data []byte, fn func([]byte) ([]byte, error)) ([]byte, error) {
+	if c == nil {
+		return fn(data)
+	}
+	key := cacheKey{sha256.Sum256(data), encoding}
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	if ok {
+		e.gen = c.gen
+	}
+	c.mu.Unlock()
+	if ok {
+		return e.data, nil
+	}
+
+	encoded, err := fn(data)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.entries[key] = &cacheEntry{data: encoded, gen: c.gen}
+	c.mu.Unlock()
+	return encoded, nil
+}
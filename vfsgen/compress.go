@@ -0,0 +1,117 @@
+package vfsgen
+
+import (
+	"bytes"
+	"compress/gzip"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// entry is a file or directory of the input filesystem.
+type entry struct {
+	dir  *dirInfo  // Set for directories.
+	file *fileInfo // Set for files.
+	data []byte    // Uncompressed content of the file.
+
+	gz      []byte   // Gzip compressed content, nil if it is not smaller than data.
+	encoded [][]byte // Content in each additional encoding, nil if it is not smaller than data.
+}
+
+// compressor compresses the content of files, taking them from the cache if
+// they were compressed before.
+type compressor struct {
+	level     int
+	encodings []Encoding
+	cache     *Cache
+	workers   int
+}
+
+// newCompressor returns a compressor for the options.
+func newCompressor(opt Options) *compressor {
+	return &compressor{
+		level:     opt.CompressionLevel,
+		encodings: opt.Encodings,
+		cache:     opt.Cache,
+		workers:   runtime.GOMAXPROCS(0),
+	}
+}
+
+// compress sets the compressed content of file entry e.
+func (c *compressor) compress(e *entry) error {
+	gz, err := c.cache.encode("gzip/"+strconv.Itoa(c.level), e.data, c.gzip)
+	if err != nil {
+		return err
+	}
+	if len(gz) < len(e.data) {
+		e.gz = gz
+	}
+
+	e.encoded = make([][]byte, len(c.encodings))
+	for i, enc := range c.encodings {
+		encoded, err := c.cache.encode(enc.Name, e.data, enc.encode)
+		if err != nil {
+			return err
+		}
+		if len(encoded) < len(e.data) {
+			e.encoded[i] = encoded
+		}
+	}
+	return nil
+}
+
+// gzip returns data gzip compressed at the compression level.
+func (c *compressor) gzip(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gw, err := gzip.NewWriterLevel(&buf, c.level)
+	if err != nil {
+		return nil, err
+	}
+	_, err = gw.Write(data)
+	if err != nil {
+		return nil, err
+	}
+	err = gw.Close()
+	return buf.Bytes(), err
+}
+
+// compressEntries compresses the file entries on a pool of workers. The largest
+// files are started on first such that they don't hold up the generation at the
+// end. If compressing files fails, the error of the first of them is returned.
+func compressEntries(entries []*entry, c *compressor) error {
+	var files []int
+	for i, e := range entries {
+		if e.file != nil {
+			files = append(files, i)
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return len(entries[files[i]].data) > len(entries[files[j]].data)
+	})
+
+	errs := make([]error, len(entries))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < c.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				errs[i] = c.compress(entries[i])
+			}
+		}()
+	}
+	for _, i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -10,6 +10,10 @@ Features:
 
 -	Enables direct access to internal gzip compressed bytes via an optional interface.
 
+-	Optionally stores files in additional encodings (i.e. brotli, zstd) as well.
+
+-	Optionally stores file contents in a directory that is included with go:embed.
+
 -	Outputs `gofmt`ed Go code.
 */
 package vfsgen
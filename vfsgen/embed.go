@@ -0,0 +1,131 @@
+package vfsgen
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
+// DefaultEmbedDir returns the directory that holds the embedded files of the
+// generated file at path filename, if Options.EmbedDir is left empty.
+func DefaultEmbedDir(filename string) string {
+	return filename[:len(filename)-len(filepath.Ext(filename))] + "_files"
+}
+
+// embedder writes file contents to the embedded directory, each file is named
+// after the hash of its content such that equal contents are stored only once.
+type embedder struct {
+	dir     string          // Directory on disk.
+	rel     string          // Slash separated path of dir, relative to the generated file.
+	written map[string]bool // Names of the files that were written in this generation.
+}
+
+// newEmbedder checks that go:embed can be used for the generated file and
+// creates the embedded directory if it doesn't exist. Files from an earlier
+// generation are kept, since they are named after their content they don't
+// have to be written again if it didn't change.
+func newEmbedder(opt Options) (*embedder, error) {
+	err := checkGo116(filepath.Dir(opt.Filename), "go:embed")
+	if err != nil {
+		return nil, err
+	}
+
+	e := &embedder{
+		dir:     filepath.Join(filepath.Dir(opt.Filename), filepath.FromSlash(opt.EmbedDir)),
+		rel:     opt.EmbedDir,
+		written: map[string]bool{},
+	}
+	err = os.MkdirAll(e.dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create embed dir: %w", err)
+	}
+	return e, nil
+}
+
+// writeContent writes data to the embedded directory and writes the Go
+// expression that reads it back at runtime.
+func (e *embedder) writeContent(w io.Writer, data []byte) error {
+	sum := sha256.Sum256(data)
+	name := hex.EncodeToString(sum[:])
+	if !e.written[name] {
+		p := filepath.Join(e.dir, name)
+		if fi, err := os.Stat(p); err != nil || fi.Size() != int64(len(data)) {
+			err = ioutil.WriteFile(p, data, 0644)
+			if err != nil {
+				return fmt.Errorf("failed to write embedded file: %w", err)
+			}
+		}
+		e.written[name] = true
+	}
+	_, err := fmt.Fprintf(w, "vfsgen۰ReadEmbedded(%s)", strconv.Quote(e.rel+"/"+name))
+	return err
+}
+
+// removeStale removes the files from the embedded directory that were not
+// written during this generation.
+func (e *embedder) removeStale() error {
+	fis, err := ioutil.ReadDir(e.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read embed dir: %w", err)
+	}
+	for _, fi := range fis {
+		if e.written[fi.Name()] {
+			continue
+		}
+		err = os.RemoveAll(filepath.Join(e.dir, fi.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to remove stale embedded file: %w", err)
+		}
+	}
+	return nil
+}
+
+// goDirective matches the go directive in a go.mod file.
+var goDirective = regexp.MustCompile(`^go\s+(\d+)\.(\d+)`)
+
+// checkGo116 returns an error if the go.mod of the module that dir is in
+// declares a Go version before 1.16, which is needed for go:embed and io/fs.
+// The feature is used in the error message.
+func checkGo116(dir, feature string) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	for {
+		modp := filepath.Join(dir, "go.mod")
+		f, err := os.Open(modp)
+		if os.IsNotExist(err) {
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				return nil // Not in a module, the feature is supported by any toolchain that has it.
+			}
+			dir = parent
+			continue
+		} else if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			m := goDirective.FindStringSubmatch(s.Text())
+			if m == nil {
+				continue
+			}
+			major, _ := strconv.Atoi(m[1])
+			minor, _ := strconv.Atoi(m[2])
+			if major == 1 && minor < 16 {
+				return fmt.Errorf("%s requires go 1.16 or later, but %s declares go %s.%s", feature, modp, m[1], m[2])
+			}
+			return nil
+		}
+		return s.Err()
+	}
+}
@@ -2,13 +2,14 @@ package vfsgen
 
 import (
 	"bytes"
-	"compress/gzip"
-	"errors"
+	"fmt"
 	"io"
+	iofs "io/fs"
 	"io/ioutil"
 	"net/http"
 	"os"
 	pathpkg "path"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"text/template"
@@ -21,16 +22,41 @@ import (
 // write the output to a file specified in opt.
 func Generate(input http.FileSystem, opt Options) error {
 	opt.fillMissing()
+	err := opt.validate()
+	if err != nil {
+		return err
+	}
 
 	// Use an in-memory buffer to generate the entire output.
 	buf := new(bytes.Buffer)
 
-	err := t.ExecuteTemplate(buf, "Header", opt)
+	// The io/fs.FS is left out for modules that can't use it.
+	hdr := header{Options: opt, IOFS: checkGo116(filepath.Dir(opt.Filename), "io/fs") == nil}
+	err = t.ExecuteTemplate(buf, "Header", hdr)
 	if err != nil {
 		return err
 	}
 
-	var toc toc
+	opt.Cache.begin()
+	toc := toc{
+		encodings:  opt.Encodings,
+		compressor: newCompressor(opt),
+		fixedTime:  opt.ModTime,
+		content:    writeLiteral,
+		IOFS:       hdr.IOFS,
+	}
+	for _, enc := range opt.Encodings {
+		toc.Encodings = append(toc.Encodings, enc.Name)
+	}
+
+	if opt.Embed {
+		toc.embedder, err = newEmbedder(opt)
+		if err != nil {
+			return err
+		}
+		toc.Embed, toc.EmbedDir, toc.content = true, toc.embedder.rel, toc.embedder.writeContent
+	}
+
 	err = findAndWriteFiles(buf, input, &toc)
 	if err != nil {
 		return err
@@ -41,23 +67,86 @@ func Generate(input http.FileSystem, opt Options) error {
 		return err
 	}
 
+	if hdr.IOFS {
+		err = t.ExecuteTemplate(buf, "FS", opt)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opt.Manifest != nil {
+		err = t.ExecuteTemplate(buf, "Manifest", newManifest(opt))
+		if err != nil {
+			return err
+		}
+	}
+
+	toc.HasEmbedded = toc.embedder != nil && len(toc.embedder.written) > 0
 	err = t.ExecuteTemplate(buf, "Trailer", toc)
 	if err != nil {
 		return err
 	}
 
-	// Write output file (all at once).
-	err = ioutil.WriteFile(opt.Filename, buf.Bytes(), 0644)
-	return err
+	// Write output file (all at once), unless it didn't change such that
+	// builds that depend on it are not triggered needlessly.
+	old, err := ioutil.ReadFile(opt.Filename)
+	if err != nil || !bytes.Equal(old, buf.Bytes()) {
+		err = ioutil.WriteFile(opt.Filename, buf.Bytes(), 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	if toc.embedder != nil {
+		err = toc.embedder.removeStale()
+		if err != nil {
+			return err
+		}
+	}
+
+	opt.Cache.sweep()
+	return nil
+}
+
+// GenerateFS is like Generate, but takes an io/fs.FS as input.
+func GenerateFS(input iofs.FS, opt Options) error {
+	return Generate(vfsutil.HTTP(input), opt)
+}
+
+// header holds the options along with what the generated code may use.
+type header struct {
+	Options
+	IOFS bool // The io/fs.FS variable is generated.
 }
 
 type toc struct {
-	dirs []*dirInfo
+	dirs       []*dirInfo
+	encodings  []Encoding
+	content    contentWriter
+	embedder   *embedder
+	compressor *compressor
+	fixedTime  *time.Time
+
+	Encodings []string // Names of the additional encodings.
+
+	IOFS bool // The io/fs.FS variable is generated.
+
+	Embed       bool   // File contents are embedded with go:embed.
+	EmbedDir    string // Slash separated path of the embedded directory.
+	HasEmbedded bool   // There's at least one embedded file.
 
 	HasCompressedFile bool // There's at least one compressedFile.
 	HasFile           bool // There's at least one uncompressed file.
 }
 
+// modTime returns the modification time of a file or directory to write.
+func (toc *toc) modTime(fi os.FileInfo) time.Time {
+	if toc.fixedTime != nil {
+		return toc.fixedTime.UTC()
+	}
+	return fi.ModTime().UTC()
+}
+
 // fileInfo is a definition of a file.
 type fileInfo struct {
 	Path             string
@@ -74,10 +163,36 @@ type dirInfo struct {
 	Entries []string
 }
 
+// manifest is a definition of the manifest variable.
+type manifest struct {
+	Name    string
+	Entries []manifestEntry
+}
+
+// manifestEntry maps a logical path to the stored path.
+type manifestEntry struct {
+	Logical string
+	Stored  string
+}
+
+// newManifest returns the manifest of the options with its entries sorted.
+func newManifest(opt Options) *manifest {
+	m := &manifest{Name: opt.ManifestName}
+	for logical, stored := range opt.Manifest {
+		m.Entries = append(m.Entries, manifestEntry{
+			Logical: pathpkg.Clean("/" + logical),
+			Stored:  pathpkg.Clean("/" + stored),
+		})
+	}
+	sort.Slice(m.Entries, func(i, j int) bool { return m.Entries[i].Logical < m.Entries[j].Logical })
+	return m
+}
+
 // findAndWriteFiles recursively finds all the file paths in the given directory tree.
-// They are added to the given map as keys. Values will be safe function names
-// for each file, which will be used when generating the output code.
+// The files are compressed in parallel, after which the definitions of the files
+// and directories are written in the order they were found.
 func findAndWriteFiles(buf *bytes.Buffer, fs http.FileSystem, toc *toc) error {
+	var entries []*entry
 	walkFn := func(path string, fi os.FileInfo, r io.ReadSeeker, err error) error {
 		if err != nil {
 			// Consider all errors reading the input filesystem as fatal.
@@ -89,37 +204,18 @@ func findAndWriteFiles(buf *bytes.Buffer, fs http.FileSystem, toc *toc) error {
 			file := &fileInfo{
 				Path:             path,
 				Name:             pathpkg.Base(path),
-				ModTime:          fi.ModTime().UTC(),
+				ModTime:          toc.modTime(fi),
 				UncompressedSize: fi.Size(),
 			}
 
-			marker := buf.Len()
-
-			// Write CompressedFileInfo.
-			err = writeCompressedFileInfo(buf, file, r)
-			switch err {
-			default:
+			data, err := ioutil.ReadAll(r)
+			if err != nil {
 				return err
-			case nil:
-				toc.HasCompressedFile = true
-			// If compressed file is not smaller than original, revert and write original file.
-			case errCompressedNotSmaller:
-				_, err = r.Seek(0, io.SeekStart)
-				if err != nil {
-					return err
-				}
-
-				buf.Truncate(marker)
-
-				// Write FileInfo.
-				err = writeFileInfo(buf, file, r)
-				if err != nil {
-					return err
-				}
-				toc.HasFile = true
 			}
+
+			entries = append(entries, &entry{file: file, data: data})
 		case true:
-			entries, err := readDirPaths(fs, path)
+			paths, err := readDirPaths(fs, path)
 			if err != nil {
 				return err
 			}
@@ -127,24 +223,59 @@ func findAndWriteFiles(buf *bytes.Buffer, fs http.FileSystem, toc *toc) error {
 			dir := &dirInfo{
 				Path:    path,
 				Name:    pathpkg.Base(path),
-				ModTime: fi.ModTime().UTC(),
-				Entries: entries,
+				ModTime: toc.modTime(fi),
+				Entries: paths,
 			}
 
 			toc.dirs = append(toc.dirs, dir)
+			entries = append(entries, &entry{dir: dir})
+		}
+
+		return nil
+	}
+
+	err := vfsutil.WalkFiles(fs, "/", walkFn)
+	if err != nil {
+		return err
+	}
+
+	err = compressEntries(entries, toc.compressor)
+	if err != nil {
+		return err
+	}
 
+	for _, e := range entries {
+		if e.dir != nil {
 			// Write DirInfo.
-			err = t.ExecuteTemplate(buf, "DirInfo", dir)
+			err = t.ExecuteTemplate(buf, "DirInfo", e.dir)
 			if err != nil {
 				return err
 			}
+			continue
 		}
 
-		return nil
-	}
+		// If compressed file is not smaller than original, write original file.
+		if e.gz != nil {
+			err = writeCompressedFileInfo(buf, e.file, e.gz, toc.content)
+			if err != nil {
+				return err
+			}
+			toc.HasCompressedFile = true
+		} else {
+			err = writeFileInfo(buf, e.file, e.data, toc.content)
+			if err != nil {
+				return err
+			}
+			toc.HasFile = true
+		}
 
-	err := vfsutil.WalkFiles(fs, "/", walkFn)
-	return err
+		// Write the additional encodings and close the definition.
+		err = writeEncodings(buf, e, toc.encodings, toc.content)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // readDirPaths reads the directory named by dirname and returns
@@ -163,39 +294,65 @@ func readDirPaths(fs http.FileSystem, dirname string) ([]string, error) {
 }
 
 // writeCompressedFileInfo writes CompressedFileInfo.
-// It returns errCompressedNotSmaller if compressed file is not smaller than original.
-func writeCompressedFileInfo(w io.Writer, file *fileInfo, r io.Reader) error {
+func writeCompressedFileInfo(w io.Writer, file *fileInfo, gz []byte, content contentWriter) error {
 	err := t.ExecuteTemplate(w, "CompressedFileInfo-Before", file)
 	if err != nil {
 		return err
 	}
-	sw := &stringWriter{Writer: w}
-	gw := gzip.NewWriter(sw)
-	_, err = io.Copy(gw, r)
+	err = content(w, gz)
 	if err != nil {
 		return err
 	}
-	err = gw.Close()
-	if err != nil {
-		return err
-	}
-	if sw.N >= file.UncompressedSize {
-		return errCompressedNotSmaller
-	}
 	err = t.ExecuteTemplate(w, "CompressedFileInfo-After", file)
 	return err
 }
 
-var errCompressedNotSmaller = errors.New("compressed file is not smaller than original")
+// writeEncodings writes the content in each of the encodings that makes it smaller,
+// and closes the file definition.
+func writeEncodings(w io.Writer, e *entry, encs []Encoding, content contentWriter) error {
+	var encoded [][]byte
+	var names []string
+	for i, enc := range encs {
+		if e.encoded[i] != nil {
+			encoded, names = append(encoded, e.encoded[i]), append(names, enc.Name)
+		}
+	}
+
+	if len(encoded) > 0 {
+		_, err := io.WriteString(w, "\n\t\t\tencoded: []vfsgen۰Encoded{\n")
+		if err != nil {
+			return err
+		}
+		for i, buf := range encoded {
+			_, err = fmt.Fprintf(w, "\t\t\t\t{%s, ", strconv.Quote(names[i]))
+			if err != nil {
+				return err
+			}
+			err = content(w, buf)
+			if err != nil {
+				return err
+			}
+			_, err = io.WriteString(w, "},\n")
+			if err != nil {
+				return err
+			}
+		}
+		_, err = io.WriteString(w, "\t\t\t},\n")
+		if err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "\t\t},\n")
+	return err
+}
 
 // Write FileInfo.
-func writeFileInfo(w io.Writer, file *fileInfo, r io.Reader) error {
+func writeFileInfo(w io.Writer, file *fileInfo, data []byte, content contentWriter) error {
 	err := t.ExecuteTemplate(w, "FileInfo-Before", file)
 	if err != nil {
 		return err
 	}
-	sw := &stringWriter{Writer: w}
-	_, err = io.Copy(sw, r)
+	err = content(w, data)
 	if err != nil {
 		return err
 	}
@@ -203,8 +360,38 @@ func writeFileInfo(w io.Writer, file *fileInfo, r io.Reader) error {
 	return err
 }
 
+// contentWriter writes a Go expression of type []byte that holds data.
+type contentWriter func(w io.Writer, data []byte) error
+
+// writeLiteral writes data as a byte slice literal.
+func writeLiteral(w io.Writer, data []byte) error {
+	_, err := io.WriteString(w, "[]byte(\"")
+	if err != nil {
+		return err
+	}
+	_, err = (&stringWriter{Writer: w}).Write(data)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\")")
+	return err
+}
+
+// encodingMethods maps well known content-codings to the name of the method
+// that returns the file content in that encoding.
+var encodingMethods = map[string]string{"br": "BrotliBytes", "zstd": "ZstdBytes"}
+
 var t = template.Must(template.New("").Funcs(template.FuncMap{
 	"quote": strconv.Quote,
+	"encodingMethod": func(name string) string {
+		return encodingMethods[name]
+	},
+	"encodedMethods": func(typ string, encodings []string) interface{} {
+		return struct {
+			Type      string
+			Encodings []string
+		}{typ, encodings}
+	},
 	"comment": func(s string) (string, error) {
 		var buf bytes.Buffer
 		cw := &commentWriter{W: &buf}
@@ -223,9 +410,11 @@ var t = template.Must(template.New("").Funcs(template.FuncMap{
 
 import (
 	"bytes"
-	"compress/gzip"
+	"compress/gzip"{{if .Embed}}
+	"embed"{{end}}
 	"fmt"
-	"io"
+	"io"{{if .IOFS}}
+	iofs "io/fs"{{end}}
 	"io/ioutil"
 	"net/http"
 	"os"
@@ -245,8 +434,7 @@ var {{.VariableName}} = func() http.FileSystem {
 			modTime:          {{template "Time" .ModTime}},
 			uncompressedSize: {{.UncompressedSize}},
 {{/* This blank line separating compressedContent is neccessary to prevent potential gofmt issues. See issue #19. */}}
-			compressedContent: []byte("{{end}}{{define "CompressedFileInfo-After"}}"),
-		},
+			compressedContent: {{end}}{{define "CompressedFileInfo-After"}},
 {{end}}
 
 
@@ -254,8 +442,7 @@ var {{.VariableName}} = func() http.FileSystem {
 {{define "FileInfo-Before"}}		{{quote .Path}}: &vfsgen۰FileInfo{
 			name:    {{quote .Name}},
 			modTime: {{template "Time" .ModTime}},
-			content: []byte("{{end}}{{define "FileInfo-After"}}"),
-		},
+			content: {{end}}{{define "FileInfo-After"}},
 {{end}}
 
 
@@ -279,7 +466,54 @@ var {{.VariableName}} = func() http.FileSystem {
 
 
 
-{{define "Trailer"}}
+{{define "FS"}}
+// {{.FSVariableName}} implements io/fs.FS, providing the same files as {{.VariableName}}.
+var {{.FSVariableName}} iofs.FS = vfsgen۰IOFS{ {{- .VariableName}}.(vfsgen۰FS)}
+{{end}}
+
+
+
+{{define "Manifest"}}
+// {{.Name}} maps logical asset paths to the paths they are stored under.
+var {{.Name}} = func() vfsgen۰Manifest {
+	m := make(vfsgen۰Manifest, {{len .Entries}})
+{{range .Entries}}	m[{{quote .Logical}}] = {{quote .Stored}}
+{{end}}	return m
+}()
+
+// vfsgen۰Manifest maps logical asset paths to the paths they are stored under.
+type vfsgen۰Manifest map[string]string
+
+// Path returns the path under which the asset with logical path 'name' is stored,
+// if the asset is not in the manifest the cleaned name is returned as is.
+func (m vfsgen۰Manifest) Path(name string) string {
+	name = pathpkg.Clean("/" + name)
+	if p, ok := m[name]; ok {
+		return p
+	}
+	return name
+}
+{{end}}
+
+
+
+{{define "Trailer"}}{{if .HasEmbedded}}
+//go:embed {{.EmbedDir}}
+var vfsgen۰Embedded embed.FS
+
+// vfsgen۰ReadEmbedded returns the content of an embedded file.
+func vfsgen۰ReadEmbedded(name string) []byte {
+	b, err := vfsgen۰Embedded.ReadFile(name)
+	if err != nil {
+		// This should never happen because we generate only names of embedded files.
+		panic("unexpected error reading embedded file: " + err.Error())
+	}
+	return b
+}
+{{else if .Embed}}
+// We already imported "embed", but ended up not embedding anything. Avoid unused import error.
+var _ embed.FS
+{{end}}
 type vfsgen۰FS map[string]interface{}
 
 func (fs vfsgen۰FS) Open(path string) (http.File, error) {
@@ -320,7 +554,8 @@ type vfsgen۰CompressedFileInfo struct {
 	name              string
 	modTime           time.Time
 	compressedContent []byte
-	uncompressedSize  int64
+	uncompressedSize  int64{{if .Encodings}}
+	encoded           []vfsgen۰Encoded{{end}}
 }
 
 func (f *vfsgen۰CompressedFileInfo) Readdir(count int) ([]os.FileInfo, error) {
@@ -331,7 +566,7 @@ func (f *vfsgen۰CompressedFileInfo) Stat() (os.FileInfo, error) { return f, nil
 func (f *vfsgen۰CompressedFileInfo) GzipBytes() []byte {
 	return f.compressedContent
 }
-
+{{template "EncodedMethods" encodedMethods "vfsgen۰CompressedFileInfo" .Encodings}}
 func (f *vfsgen۰CompressedFileInfo) Name() string       { return f.name }
 func (f *vfsgen۰CompressedFileInfo) Size() int64        { return f.uncompressedSize }
 func (f *vfsgen۰CompressedFileInfo) Mode() os.FileMode  { return 0444 }
@@ -394,7 +629,8 @@ var _ = ioutil.Discard
 type vfsgen۰FileInfo struct {
 	name    string
 	modTime time.Time
-	content []byte
+	content []byte{{if .Encodings}}
+	encoded []vfsgen۰Encoded{{end}}
 }
 
 func (f *vfsgen۰FileInfo) Readdir(count int) ([]os.FileInfo, error) {
@@ -403,7 +639,7 @@ func (f *vfsgen۰FileInfo) Readdir(count int) ([]os.FileInfo, error) {
 func (f *vfsgen۰FileInfo) Stat() (os.FileInfo, error) { return f, nil }
 
 func (f *vfsgen۰FileInfo) NotWorthGzipCompressing() {}
-
+{{template "EncodedMethods" encodedMethods "vfsgen۰FileInfo" .Encodings}}
 func (f *vfsgen۰FileInfo) Name() string       { return f.name }
 func (f *vfsgen۰FileInfo) Size() int64        { return int64(len(f.content)) }
 func (f *vfsgen۰FileInfo) Mode() os.FileMode  { return 0444 }
@@ -423,6 +659,86 @@ func (f *vfsgen۰File) Close() error {
 {{else if not .HasCompressedFile}}
 // We already imported "bytes", but ended up not using it. Avoid unused import error.
 var _ = bytes.Reader{}
+{{end}}{{if .Encodings}}
+// vfsgen۰Encoded is the content of a file in an additional content encoding.
+type vfsgen۰Encoded struct {
+	name    string
+	content []byte
+}
+{{end}}{{if .IOFS}}
+// vfsgen۰IOFS implements io/fs.FS, fs.ReadDirFS, fs.ReadFileFS and fs.StatFS over vfsgen۰FS.
+type vfsgen۰IOFS struct {
+	files vfsgen۰FS
+}
+
+func (f vfsgen۰IOFS) Open(name string) (iofs.File, error) {
+	if !iofs.ValidPath(name) {
+		return nil, &iofs.PathError{Op: "open", Path: name, Err: iofs.ErrInvalid}
+	}
+	file, err := f.files.Open(name)
+	if err != nil {
+		return nil, &iofs.PathError{Op: "open", Path: name, Err: iofs.ErrNotExist}
+	}
+	if d, ok := file.(*vfsgen۰Dir); ok {
+		return vfsgen۰IODir{d}, nil
+	}
+	return file, nil
+}
+
+func (f vfsgen۰IOFS) ReadDir(name string) ([]iofs.DirEntry, error) {
+	file, err := f.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	d, ok := file.(iofs.ReadDirFile)
+	if !ok {
+		return nil, &iofs.PathError{Op: "readdir", Path: name, Err: fmt.Errorf("not a directory")}
+	}
+	return d.ReadDir(-1)
+}
+
+func (f vfsgen۰IOFS) ReadFile(name string) ([]byte, error) {
+	file, err := f.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ioutil.ReadAll(file)
+}
+
+func (f vfsgen۰IOFS) Stat(name string) (iofs.FileInfo, error) {
+	if !iofs.ValidPath(name) {
+		return nil, &iofs.PathError{Op: "stat", Path: name, Err: iofs.ErrInvalid}
+	}
+	fi, ok := f.files[pathpkg.Clean("/"+name)]
+	if !ok {
+		return nil, &iofs.PathError{Op: "stat", Path: name, Err: iofs.ErrNotExist}
+	}
+	return fi.(iofs.FileInfo), nil
+}
+
+// vfsgen۰IODir is an opened dir instance that implements io/fs.ReadDirFile.
+type vfsgen۰IODir struct {
+	*vfsgen۰Dir
+}
+
+func (d vfsgen۰IODir) ReadDir(count int) ([]iofs.DirEntry, error) {
+	fis, err := d.Readdir(count)
+	entries := make([]iofs.DirEntry, len(fis))
+	for i, fi := range fis {
+		entries[i] = vfsgen۰DirEntry{fi}
+	}
+	return entries, err
+}
+
+// vfsgen۰DirEntry implements io/fs.DirEntry for the info of a file or directory.
+type vfsgen۰DirEntry struct {
+	iofs.FileInfo
+}
+
+func (e vfsgen۰DirEntry) Type() iofs.FileMode          { return e.Mode().Type() }
+func (e vfsgen۰DirEntry) Info() (iofs.FileInfo, error) { return e.FileInfo, nil }
 {{end}}
 // vfsgen۰DirInfo is a static definition of a directory.
 type vfsgen۰DirInfo struct {
@@ -473,6 +789,22 @@ func (d *vfsgen۰Dir) Readdir(count int) ([]os.FileInfo, error) {
 
 
 
+{{define "EncodedMethods"}}{{if .Encodings}}
+// EncodedBytes returns the content in content encoding name, or nil if it isn't stored in it.
+func (f *{{.Type}}) EncodedBytes(name string) []byte {
+	for _, e := range f.encoded {
+		if e.name == name {
+			return e.content
+		}
+	}
+	return nil
+}
+{{range $enc := .Encodings}}{{with $m := encodingMethod $enc}}
+func (f *{{$.Type}}) {{$m}}() []byte { return f.EncodedBytes({{quote $enc}}) }
+{{end}}{{end}}{{end}}{{end}}
+
+
+
 {{define "Time"}}
 {{- if .IsZero -}}
 	time.Time{}
@@ -1,6 +1,10 @@
 package vfsgen_test
 
 import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
@@ -8,9 +12,13 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/wirebase/wire/vfsgen"
+	"github.com/wirebase/wire/vfsgen/vfsutil"
 )
 
 func testFilesystem(tb testing.TB, files map[*[]string]string) (dir string, fs http.FileSystem, clean func()) {
@@ -58,6 +66,17 @@ func testFilesystem(tb testing.TB, files map[*[]string]string) (dir string, fs h
 // 	}
 // }
 
+// testEncodings uses deflate to stand in for encodings that are not in the
+// standard library
+var testEncodings = []vfsgen.Encoding{
+	{Name: "deflate", NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(w, flate.BestCompression)
+	}},
+	{Name: "br", NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(w, flate.BestSpeed)
+	}},
+}
+
 func TestGenerate_buildAndGofmt(t *testing.T) {
 	tempDir, _, clean := testFilesystem(t, nil)
 	defer clean()
@@ -78,6 +97,9 @@ func TestGenerate_buildAndGofmt(t *testing.T) {
 	cases := []struct {
 		filename  string
 		fs        http.FileSystem
+		manifest  map[string]string
+		encodings []vfsgen.Encoding
+		embed     bool
 		wantError func(error) bool // Nil function means want nil error.
 	}{
 		{
@@ -102,6 +124,61 @@ func TestGenerate_buildAndGofmt(t *testing.T) {
 			filename: "onlycompressed.go",
 			fs:       compfs,
 		},
+		{
+			// With a manifest.
+			filename: "manifest.go",
+			fs:       compfs,
+			manifest: map[string]string{
+				"/compressable-file.txt": "/compressable-file.0123456789abcdef.txt",
+				"a.txt":                  "a.0123456789abcdef.txt",
+			},
+		},
+		{
+			// Additional encodings, no compressed files.
+			filename:  "encodednocompressed.go",
+			fs:        notcompfs,
+			encodings: testEncodings,
+		},
+		{
+			// Additional encodings, only compressed files.
+			filename:  "encodedcompressed.go",
+			fs:        compfs,
+			encodings: testEncodings,
+		},
+		{
+			// Embedded, empty.
+			filename: "embedempty.go",
+			fs:       emptyfs,
+			embed:    true,
+		},
+		{
+			// Embedded, no compressed files.
+			filename:  "embednocompressed.go",
+			fs:        notcompfs,
+			encodings: testEncodings,
+			embed:     true,
+		},
+		{
+			// Embedded, only compressed files.
+			filename:  "embedcompressed.go",
+			fs:        compfs,
+			encodings: testEncodings,
+			embed:     true,
+		},
+		{
+			// From an io/fs.FS.
+			filename: "iofs.go",
+			fs: vfsutil.HTTP(fstest.MapFS{
+				"dir/compressable-file.txt": {Data: []byte(strings.Repeat(" Go!", 128))},
+			}),
+		},
+		{
+			// Invalid encodings.
+			filename:  "invalidencoding.go",
+			fs:        compfs,
+			encodings: []vfsgen.Encoding{{Name: "gzip", NewWriter: testEncodings[0].NewWriter}},
+			wantError: func(err error) bool { return err != nil },
+		},
 	}
 
 	for i, c := range cases {
@@ -110,6 +187,9 @@ func TestGenerate_buildAndGofmt(t *testing.T) {
 			err := vfsgen.Generate(c.fs, vfsgen.Options{
 				Filename:    filename,
 				PackageName: "test",
+				Manifest:    c.manifest,
+				Encodings:   c.encodings,
+				Embed:       c.embed,
 			})
 
 			switch {
@@ -134,3 +214,273 @@ func TestGenerate_buildAndGofmt(t *testing.T) {
 	_ = tempDir
 
 }
+
+func TestGenerate_embedRequiresGo116(t *testing.T) {
+	dir, _, clean := testFilesystem(t, map[*[]string]string{
+		&[]string{"go.mod"}: "module app\n\ngo 1.13\n",
+	})
+	defer clean()
+
+	_, fs, clean1 := testFilesystem(t, map[*[]string]string{
+		&[]string{"a.txt"}: "same",
+		&[]string{"b.txt"}: "same",
+	})
+	defer clean1()
+
+	err := vfsgen.Generate(fs, vfsgen.Options{
+		Filename: filepath.Join(dir, "assets.go"),
+		Embed:    true,
+	})
+	if err == nil || !strings.Contains(err.Error(), "go:embed requires go 1.16 or later") {
+		t.Fatalf("expected error about the go version, got: %v", err)
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module app\n\ngo 1.16\n"), 0777)
+	err = vfsgen.Generate(fs, vfsgen.Options{
+		Filename: filepath.Join(dir, "assets.go"),
+		Embed:    true,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	fis, _ := ioutil.ReadDir(filepath.Join(dir, "assets_files"))
+	if len(fis) != 1 {
+		t.Fatalf("expected equal content to be embedded once, got: %d files", len(fis))
+	}
+}
+
+func TestGenerate_ioFS(t *testing.T) {
+	_, fs, clean := testFilesystem(t, map[*[]string]string{
+		&[]string{"a.txt"}:        strings.Repeat(" Go!", 128),
+		&[]string{"dir", "b.txt"}: "Not compressable.",
+	})
+	defer clean()
+
+	// the generated io/fs.FS is checked by a test in the generated package
+	check := func(t *testing.T, gomod string, generate func(opt vfsgen.Options) error) {
+		dir, _, clean := testFilesystem(t, map[*[]string]string{
+			&[]string{"go.mod"}: "module app\n\n" + gomod + "\n",
+			&[]string{"assets_test.go"}: `package app
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestFS(t *testing.T) {
+	if err := fstest.TestFS(assetsFS, "a.txt", "dir/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+}
+`,
+		})
+		defer clean()
+
+		err := generate(vfsgen.Options{Filename: filepath.Join(dir, "assets.go"), PackageName: "app", Encodings: testEncodings})
+		if err != nil {
+			t.Fatalf("failed to generate: %v", err)
+		}
+
+		cmd := exec.Command("go", "test", ".")
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("expected generated fs to pass fstest, got: %v\n%s", err, out)
+		}
+	}
+
+	t.Run("http.FileSystem input", func(t *testing.T) {
+		check(t, "go 1.16", func(opt vfsgen.Options) error { return vfsgen.Generate(fs, opt) })
+	})
+
+	t.Run("embedded", func(t *testing.T) {
+		check(t, "go 1.16", func(opt vfsgen.Options) error {
+			opt.Embed = true
+			return vfsgen.Generate(fs, opt)
+		})
+	})
+
+	t.Run("io/fs.FS input", func(t *testing.T) {
+		check(t, "go 1.16", func(opt vfsgen.Options) error {
+			return vfsgen.GenerateFS(fstest.MapFS{
+				"a.txt":     {Data: []byte(strings.Repeat(" Go!", 128))},
+				"dir/b.txt": {Data: []byte("Not compressable.")},
+			}, opt)
+		})
+	})
+
+	t.Run("before go 1.16", func(t *testing.T) {
+		dir, _, clean := testFilesystem(t, map[*[]string]string{
+			&[]string{"go.mod"}: "module app\n\ngo 1.13\n",
+		})
+		defer clean()
+
+		filename := filepath.Join(dir, "assets.go")
+		err := vfsgen.Generate(fs, vfsgen.Options{Filename: filename, PackageName: "app"})
+		if err != nil {
+			t.Fatalf("failed to generate: %v", err)
+		}
+
+		if data, _ := ioutil.ReadFile(filename); bytes.Contains(data, []byte("io/fs")) {
+			t.Fatalf("expected no io/fs.FS for a module before go 1.16")
+		}
+
+		cmd := exec.Command("go", "build", ".")
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("expected generated code to build, got: %v\n%s", err, out)
+		}
+	})
+}
+
+func TestGenerate_cache(t *testing.T) {
+	dir, _, clean := testFilesystem(t, map[*[]string]string{
+		&[]string{"go.mod"}: "module app\n\ngo 1.16\n",
+	})
+	defer clean()
+
+	srcDir, fs, clean1 := testFilesystem(t, map[*[]string]string{
+		&[]string{"a.txt"}: strings.Repeat(" Go!", 128),
+		&[]string{"b.txt"}: strings.Repeat(" Wire!", 128),
+	})
+	defer clean1()
+
+	var encoded int32
+	opt := vfsgen.Options{
+		Filename: filepath.Join(dir, "assets.go"),
+		Cache:    vfsgen.NewCache(),
+		Embed:    true,
+		Encodings: []vfsgen.Encoding{{Name: "br", NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+			atomic.AddInt32(&encoded, 1)
+			return flate.NewWriter(w, flate.BestSpeed)
+		}}},
+	}
+
+	err := vfsgen.Generate(fs, opt)
+	if err != nil || encoded != 2 {
+		t.Fatalf("expected both files to be encoded, got: %d %v", encoded, err)
+	}
+
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	os.Chtimes(opt.Filename, past, past)
+	err = vfsgen.Generate(fs, opt)
+	if err != nil || encoded != 2 {
+		t.Fatalf("expected no files to be encoded again, got: %d %v", encoded, err)
+	}
+
+	if fi, _ := os.Stat(opt.Filename); !fi.ModTime().Equal(past) {
+		t.Fatalf("expected unchanged output not to be written, got mod time: %v", fi.ModTime())
+	}
+
+	ioutil.WriteFile(filepath.Join(srcDir, "b.txt"), []byte(strings.Repeat(" Changed!", 128)), 0777)
+	err = vfsgen.Generate(fs, opt)
+	if err != nil || encoded != 3 {
+		t.Fatalf("expected only the changed file to be encoded, got: %d %v", encoded, err)
+	}
+
+	if fi, _ := os.Stat(opt.Filename); fi.ModTime().Equal(past) {
+		t.Fatalf("expected changed output to be written")
+	}
+
+	if n := opt.Cache.Len(); n != 4 {
+		t.Fatalf("expected the old content to be dropped from the cache, got: %d entries", n)
+	}
+
+	fis, _ := ioutil.ReadDir(filepath.Join(dir, "assets_files"))
+	if len(fis) != 4 {
+		t.Fatalf("expected stale embedded files to be removed, got: %d files", len(fis))
+	}
+}
+
+func TestGenerate_parallel(t *testing.T) {
+	files := map[*[]string]string{}
+	for i := 0; i < 64; i++ {
+		files[&[]string{"dir" + strconv.Itoa(i%4), strconv.Itoa(i) + ".txt"}] = strings.Repeat("file "+strconv.Itoa(i), i*i)
+	}
+
+	_, fs, clean := testFilesystem(t, files)
+	defer clean()
+
+	dir, _, clean1 := testFilesystem(t, nil)
+	defer clean1()
+
+	generate := func(name string, level int) []byte {
+		filename := filepath.Join(dir, name)
+		err := vfsgen.Generate(fs, vfsgen.Options{
+			Filename:         filename,
+			CompressionLevel: level,
+			Encodings:        testEncodings,
+		})
+		if err != nil {
+			t.Fatalf("failed to generate: %v", err)
+		}
+
+		data, _ := ioutil.ReadFile(filename)
+		return data
+	}
+
+	fast := generate("fast.go", gzip.BestSpeed)
+	for i := 0; i < 3; i++ {
+		if again := generate("again.go", gzip.BestSpeed); !bytes.Equal(fast, again) {
+			t.Fatalf("expected output to be deterministic")
+		}
+	}
+
+	if best := generate("best.go", gzip.BestCompression); len(best) >= len(fast) {
+		t.Fatalf("expected best compression to be smaller than fast, got: %d >= %d", len(best), len(fast))
+	}
+
+	err := vfsgen.Generate(fs, vfsgen.Options{Filename: filepath.Join(dir, "x.go"), CompressionLevel: 10})
+	if err == nil || !strings.Contains(err.Error(), "invalid compression level") {
+		t.Fatalf("expected invalid compression level error, got: %v", err)
+	}
+}
+
+func TestGenerate_reproducible(t *testing.T) {
+	srcDir, fs, clean := testFilesystem(t, map[*[]string]string{
+		&[]string{"a.txt"}:        strings.Repeat(" Go!", 128),
+		&[]string{"dir", "b.txt"}: "Not compressable.",
+	})
+	defer clean()
+
+	dir, _, clean1 := testFilesystem(t, nil)
+	defer clean1()
+
+	os.Setenv("SOURCE_DATE_EPOCH", "1577836800")
+	defer os.Unsetenv("SOURCE_DATE_EPOCH")
+
+	epoch, err := vfsgen.SourceDateEpoch()
+	if err != nil || !epoch.Equal(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected epoch from the environment, got: %v %v", epoch, err)
+	}
+
+	generate := func(name string) []byte {
+		filename := filepath.Join(dir, name)
+		err := vfsgen.Generate(fs, vfsgen.Options{Filename: filename, ModTime: &epoch})
+		if err != nil {
+			t.Fatalf("failed to generate: %v", err)
+		}
+
+		data, _ := ioutil.ReadFile(filename)
+		return data
+	}
+
+	first := generate("first.go")
+	past := time.Now().Add(-time.Hour)
+	for _, p := range []string{"a.txt", "dir", filepath.Join("dir", "b.txt")} {
+		os.Chtimes(filepath.Join(srcDir, p), past, past)
+	}
+
+	if second := generate("second.go"); !bytes.Equal(first, second) {
+		t.Fatalf("expected output to not depend on mod times")
+	}
+
+	if !bytes.Contains(first, []byte("time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)")) {
+		t.Fatalf("expected mod times to be the source date epoch")
+	}
+
+	os.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	if _, err = vfsgen.SourceDateEpoch(); err == nil {
+		t.Fatalf("expected invalid epoch to fail")
+	}
+}
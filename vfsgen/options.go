@@ -1,10 +1,47 @@
 package vfsgen
 
 import (
+	"bytes"
+	"compress/gzip"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// Encoding is a content encoding in which files are stored in addition to gzip,
+// such as brotli or zstd. Since the standard library doesn't provide writers for
+// these, the encoder has to be provided.
+type Encoding struct {
+	// Name is the content-coding as used in the Accept-Encoding header, i.e: "br".
+	Name string
+
+	// NewWriter returns a writer that encodes everything written to w, the
+	// encoded content must be complete after it is closed. Files are encoded
+	// in parallel, so it must be safe to call concurrently.
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+}
+
+// encode returns data in the encoding.
+func (enc Encoding) encode(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	ew, err := enc.NewWriter(&buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s writer: %w", enc.Name, err)
+	}
+	_, err = ew.Write(data)
+	if err != nil {
+		return nil, err
+	}
+	err = ew.Close()
+	return buf.Bytes(), err
+}
+
 // Options for vfsgen code generation.
 type Options struct {
 	// Filename of the generated Go code output (including extension).
@@ -26,6 +63,69 @@ type Options struct {
 	// VariableComment is the comment of the http.FileSystem variable in the generated code.
 	// If left empty, it defaults to "{{.VariableName}} statically implements the virtual filesystem provided to vfsgen.".
 	VariableComment string
+
+	// FSVariableName is the name of the io/fs.FS variable in the generated code,
+	// it provides the same files as the http.FileSystem variable. It is only
+	// generated if the go.mod of the output file declares go 1.16 or later.
+	// If left empty, it defaults to "{{.VariableName}}FS".
+	FSVariableName string
+
+	// Manifest maps logical asset paths to the paths under which they are stored
+	// in the filesystem, i.e: "/main.wasm" to "/main.3fa9c1d2e0b4a785.wasm". If it
+	// is not nil a manifest variable is generated to resolve asset paths at runtime.
+	Manifest map[string]string
+
+	// Encodings holds additional content encodings in which files are stored,
+	// a file is only stored in an encoding if that makes it smaller. The encoded
+	// bytes can be accessed via an optional EncodedBytes(name string) []byte method
+	// on the file info, for "br" and "zstd" there are also BrotliBytes and ZstdBytes.
+	Encodings []Encoding
+
+	// Embed stores the file contents in a directory next to the generated file
+	// that is embedded with a //go:embed directive, instead of in byte literals.
+	// The go.mod of the generated package must declare go 1.16 or later.
+	Embed bool
+
+	// EmbedDir is the slash separated path of the directory that holds the
+	// embedded files, relative to the directory of Filename. Files that are no
+	// longer used are removed from it on every generation.
+	// If left empty, it defaults to DefaultEmbedDir(base(Filename)).
+	EmbedDir string
+
+	// CompressionLevel is the gzip compression level, from gzip.HuffmanOnly to
+	// gzip.BestCompression. Use gzip.BestSpeed to generate quickly during
+	// development and gzip.BestCompression for release builds.
+	// If left zero, it defaults to gzip.DefaultCompression.
+	CompressionLevel int
+
+	// ModTime, if not nil, replaces the modification time of all files and
+	// directories, such that identical input yields identical output no matter
+	// when it was written. Point it to the zero time to leave modification
+	// times out, or use SourceDateEpoch to honor SOURCE_DATE_EPOCH.
+	ModTime *time.Time
+
+	// Cache holds the compressed content of files from earlier generations, such
+	// that only files that changed are compressed again. If left nil, all files
+	// are compressed on every generation.
+	Cache *Cache
+
+	// ManifestName is the name of the manifest variable in the generated code.
+	// If left empty, it defaults to "{{.VariableName}}Manifest".
+	ManifestName string
+}
+
+// SourceDateEpoch returns the time in the SOURCE_DATE_EPOCH environment variable
+// as used for reproducible builds, or the zero time if it is not set.
+func SourceDateEpoch() (time.Time, error) {
+	v := os.Getenv("SOURCE_DATE_EPOCH")
+	if v == "" {
+		return time.Time{}, nil
+	}
+	sec, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q: %w", v, err)
+	}
+	return time.Unix(sec, 0).UTC(), nil
 }
 
 // fillMissing sets default values for mandatory options that are left empty.
@@ -39,7 +139,46 @@ func (opt *Options) fillMissing() {
 	if opt.Filename == "" {
 		opt.Filename = fmt.Sprintf("%s_vfsdata.go", strings.ToLower(opt.VariableName))
 	}
+	if opt.FSVariableName == "" {
+		opt.FSVariableName = opt.VariableName + "FS"
+	}
+	if opt.ManifestName == "" {
+		opt.ManifestName = opt.VariableName + "Manifest"
+	}
+	if opt.EmbedDir == "" {
+		opt.EmbedDir = DefaultEmbedDir(filepath.Base(opt.Filename))
+	}
+	if opt.CompressionLevel == 0 {
+		opt.CompressionLevel = gzip.DefaultCompression
+	}
 	if opt.VariableComment == "" {
 		opt.VariableComment = fmt.Sprintf("%s statically implements the virtual filesystem provided to vfsgen.", opt.VariableName)
 	}
 }
+
+// validate checks the options for values that can't work.
+func (opt *Options) validate() error {
+	if opt.CompressionLevel < gzip.HuffmanOnly || opt.CompressionLevel > gzip.BestCompression {
+		return fmt.Errorf("invalid compression level %d", opt.CompressionLevel)
+	}
+	seen := map[string]bool{"gzip": true}
+	for _, enc := range opt.Encodings {
+		switch {
+		case enc.Name == "":
+			return errors.New("encoding has no name")
+		case seen[enc.Name]:
+			return fmt.Errorf("encoding %q is configured more than once", enc.Name)
+		case enc.NewWriter == nil:
+			return fmt.Errorf("encoding %q has no writer", enc.Name)
+		}
+		seen[enc.Name] = true
+	}
+	if opt.Embed {
+		dir := opt.EmbedDir
+		if dir != pathpkg.Clean(dir) || pathpkg.IsAbs(dir) || dir == "." || strings.HasPrefix(dir, "..") ||
+			strings.HasPrefix(pathpkg.Base(dir), ".") || strings.HasPrefix(pathpkg.Base(dir), "_") {
+			return fmt.Errorf("embed dir %q must be a clean relative path that go:embed can include", dir)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package vfsutil
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+)
+
+// HTTP returns an http.FileSystem that provides the files of fsys, like
+// http.FS. Files that don't support seeking are read into memory when
+// opened, such that every file can be walked with WalkFiles.
+func HTTP(fsys fs.FS) http.FileSystem {
+	return seekableFS{http.FS(fsys)}
+}
+
+// seekableFS makes sure every file it opens can seek.
+type seekableFS struct {
+	fs http.FileSystem
+}
+
+func (sfs seekableFS) Open(name string) (http.File, error) {
+	f, err := sfs.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		return f, err
+	}
+	if _, err := f.Seek(0, io.SeekCurrent); err == nil {
+		return f, nil
+	}
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &memFile{File: f, Reader: bytes.NewReader(data)}, nil
+}
+
+// memFile is a file whose content was read into memory.
+type memFile struct {
+	http.File
+	*bytes.Reader
+}
+
+func (f *memFile) Read(p []byte) (int, error) { return f.Reader.Read(p) }
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	return f.Reader.Seek(offset, whence)
+}
+
+// httpPath converts the slash separated fs.FS path name to an http.FileSystem path.
+func httpPath(name string) string {
+	return pathpkg.Clean("/" + name)
+}
+
+// fsPath converts an http.FileSystem path to an fs.FS path.
+func fsPath(name string) string {
+	if name == "/" {
+		return "."
+	}
+	return name[1:]
+}
+
+// ReadDirFS is like ReadDir, but reads the directory from fsys.
+func ReadDirFS(fsys fs.FS, name string) ([]os.FileInfo, error) {
+	return ReadDir(HTTP(fsys), httpPath(name))
+}
+
+// StatFS is like Stat, but describes the file in fsys.
+func StatFS(fsys fs.FS, name string) (os.FileInfo, error) {
+	return Stat(HTTP(fsys), httpPath(name))
+}
+
+// WalkFS is like Walk, but walks fsys. Paths are fs.FS paths, the root
+// directory is ".".
+func WalkFS(fsys fs.FS, root string, walkFn filepath.WalkFunc) error {
+	return Walk(HTTP(fsys), httpPath(root), func(path string, info os.FileInfo, err error) error {
+		return walkFn(fsPath(path), info, err)
+	})
+}
+
+// WalkFilesFS is like WalkFiles, but walks fsys. Paths are fs.FS paths, the
+// root directory is ".".
+func WalkFilesFS(fsys fs.FS, root string, walkFn WalkFilesFunc) error {
+	return WalkFiles(HTTP(fsys), httpPath(root), func(path string, info os.FileInfo, rs io.ReadSeeker, err error) error {
+		return walkFn(fsPath(path), info, rs, err)
+	})
+}
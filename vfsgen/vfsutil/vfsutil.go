@@ -1,4 +1,5 @@
-// Package vfsutil implements some I/O utility functions for http.FileSystem.
+// Package vfsutil implements some I/O utility functions for http.FileSystem,
+// with equivalents that operate on io/fs.FS.
 package vfsutil
 
 import (
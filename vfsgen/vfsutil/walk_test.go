@@ -2,12 +2,14 @@ package vfsutil_test
 
 import (
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
 	"reflect"
 	"testing"
+	"testing/fstest"
 
 	"github.com/wirebase/wire/vfsgen/vfsutil"
 )
@@ -137,3 +139,67 @@ func TestWalk(t *testing.T) {
 		}
 	})
 }
+
+// noSeekFS hides the Seek method of the files it opens
+type noSeekFS struct{ fs.FS }
+
+func (nfs noSeekFS) Open(name string) (fs.File, error) {
+	f, err := nfs.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := f.(fs.ReadDirFile); ok {
+		return f, nil
+	}
+
+	return struct{ fs.File }{f}, nil
+}
+
+func TestWalkFS(t *testing.T) {
+	fsys := noSeekFS{fstest.MapFS{
+		"a-file.txt":          {Data: []byte("It has stuff.")},
+		"folderA/entry-A.txt": {Data: []byte("Alpha.")},
+		"skip-me/entry-C.txt": {Data: []byte("Gamma.")},
+	}}
+
+	var visits []string
+	err := vfsutil.WalkFilesFS(fsys, ".", func(path string, fi os.FileInfo, r io.ReadSeeker, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if path == "skip-me" {
+			return filepath.SkipDir
+		}
+
+		if !fi.IsDir() {
+			r.Seek(2, io.SeekStart)
+			b, _ := ioutil.ReadAll(r)
+			if len(b) < 1 {
+				t.Fatal("expected some bytes to be read after seeking")
+			}
+		}
+
+		visits = append(visits, path)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walk shouldnt fail, got: %v", err)
+	}
+
+	exp := []string{".", "a-file.txt", "folderA", "folderA/entry-A.txt"}
+	if !reflect.DeepEqual(visits, exp) {
+		t.Fatalf("expected visits: %v, got: %v", exp, visits)
+	}
+
+	fis, err := vfsutil.ReadDirFS(fsys, "folderA")
+	if err != nil || len(fis) != 1 || fis[0].Name() != "entry-A.txt" {
+		t.Fatalf("expected dir to be read, got: %v %v", fis, err)
+	}
+
+	fi, err := vfsutil.StatFS(fsys, "a-file.txt")
+	if err != nil || fi.Size() != 13 {
+		t.Fatalf("expected file to be stat-ed, got: %v %v", fi, err)
+	}
+}